@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/google/uuid"
+)
+
+// invitationSweeperMetrics is published on /debug/vars
+var invitationSweeperMetrics = expvar.NewMap("invitation_sweeper")
+
+type ResendActivationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// @Summary		Resend activation email
+// @Description	Sends a new activation link to the email if an inactive account exists for it, previous links stop working
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		ResendActivationPayload	true	"User email"
+// @Success		202		{string}	string	"Activation link sent if the account exists"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		429		{object}	error	"Too many activation emails for the address"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/activation/resend	[post]
+func (app *application) resendActivationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendActivationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// limited for every email, existing or not, so the limit tells nothing about the account
+	if allow, retryAfter := app.resendLimiter.Allow(strings.ToLower(payload.Email)); !allow {
+		app.rateLimitExceededResponse(w, r, retryAfter.String())
+		return
+	}
+
+	// same response for unknown and already active accounts, like forgot password
+	accepted := "if an inactive account exists for this email, an activation link has been sent"
+	plainToken := uuid.New().String()
+	user, err := app.store.Users.ResendInvitation(r.Context(), payload.Email, hashToken(plainToken), app.config.mail.exp)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			if err := jsonResponse(w, http.StatusAccepted, accepted); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.sendActivationEmail(user, plainToken); err != nil {
+		app.logger.Errorw("error sending activation email", "error", err)
+	}
+	if err := jsonResponse(w, http.StatusAccepted, accepted); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) sendActivationEmail(user *store.User, plainToken string) error {
+	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: activationURL,
+	}
+	return app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+}
+
+// sweepExpiredInvitations purges the users which never activated before their invitation expired,
+// so their username and email can be registered again. It runs until ctx is done
+func (app *application) sweepExpiredInvitations(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeExpiredInvitations(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) purgeExpiredInvitations(ctx context.Context) {
+	users, invitations, err := app.store.Users.PurgeExpiredInvitations(ctx)
+	if err != nil {
+		invitationSweeperMetrics.Add("errors", 1)
+		app.logger.Errorw("error purging expired invitations", "error", err)
+		return
+	}
+	invitationSweeperMetrics.Add("users_purged", users)
+	invitationSweeperMetrics.Add("invitations_purged", invitations)
+	lastRun := new(expvar.String)
+	lastRun.Set(time.Now().UTC().Format(time.RFC3339))
+	invitationSweeperMetrics.Set("last_run", lastRun)
+	if users > 0 {
+		app.logger.Infow("purged expired invitations", "users", users, "invitations", invitations)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+)
+
+func TestResendActivation(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	resend := func(t *testing.T, email string) *httptest.ResponseRecorder {
+		t.Helper()
+		body := fmt.Sprintf(`{"email": %q}`, email)
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/activation/resend", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		return executeRequest(req, mux)
+	}
+
+	t.Run("should answer the same for unknown and active accounts", func(t *testing.T) {
+		inactive := resend(t, "inactive@example.com")
+		checkResponseCode(t, http.StatusAccepted, inactive.Code)
+		for _, email := range []string{"unknown@example.com", "active@example.com"} {
+			rr := resend(t, email)
+			checkResponseCode(t, http.StatusAccepted, rr.Code)
+			if rr.Body.String() != inactive.Body.String() {
+				t.Errorf("expected the same response for %s, got %q", email, rr.Body.String())
+			}
+		}
+		if sent := app.mailer.(*mailer.MockMailer).Sent; len(sent) != 1 || sent[0] != "inactive@example.com" {
+			t.Errorf("expected an email to the inactive account only, got %v", sent)
+		}
+	})
+	t.Run("should limit the emails to an address whether it has an account or not", func(t *testing.T) {
+		// the test limiter allows 3 emails per address, both were resent once already
+		for _, email := range []string{"inactive@example.com", "unknown@example.com"} {
+			for i := 1; i < 3; i++ {
+				checkResponseCode(t, http.StatusAccepted, resend(t, email).Code)
+			}
+			checkResponseCode(t, http.StatusTooManyRequests, resend(t, strings.ToUpper(email)).Code)
+		}
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type SuspendUserPayload struct {
+	Reason    string    `json:"reason" validate:"required,max=255"`
+	ExpiresAt time.Time `json:"expires_at" validate:"required"`
+}
+
+// @Summary		Searches users
+// @Description	Lists the users matching the search, inactive accounts included
+// @Tags			admin
+// @Produce		json
+// @Param			limit	query		int		false	"Limit | default: 20"
+// @Param			offset	query		int		false	"Offset | default: 0"
+// @Param			search	query		string	false	"Search by username/email"
+// @Param			role	query		string	false	"Role name"
+// @Param			active	query		bool	false	"Activation status"
+// @Success		200		{object}	[]store.User
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users	[get]
+func (app *application) searchUsersHandler(w http.ResponseWriter, r *http.Request) {
+	uq := store.PaginatedUserQuery{
+		Limit:  20,
+		Offset: 0,
+	}
+	uq = uq.Parse(r)
+
+	if err := Validate.Struct(uq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	users, err := app.store.Users.Search(r.Context(), uq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, users); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Suspends a user
+// @Description	Blocks the user from signing in until expires_at and signs the user out everywhere
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			userID	path		int					true	"User ID"
+// @Param			payload	body		SuspendUserPayload	true	"Reason and expiry"
+// @Success		204		{string}	string				"User suspended"
+// @Failure		400		{object}	error				"Bad request"
+// @Failure		403		{object}	error				"Forbidden"
+// @Failure		404		{object}	error				"User not found"
+// @Failure		500		{object}	error				"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/suspension	[put]
+func (app *application) suspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	var payload SuspendUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if !payload.ExpiresAt.After(time.Now()) {
+		app.badRequestResponse(w, r, fmt.Errorf("expires_at must be in the future"))
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	if err := app.store.Users.Suspend(ctx, user.ID, payload.ExpiresAt, payload.Reason); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	// the refresh tokens are gone with the suspension, the access tokens still need revoking
+	if err := app.cacheStorage.Tokens.RevokeUser(ctx, user.ID, app.config.auth.token.exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+
+	suspended := *user
+	suspended.SuspendedUntil = &payload.ExpiresAt
+	suspended.SuspensionReason = payload.Reason
+	app.audit.Log(r, auditUserSuspend, AuditTarget{Type: "user", ID: user.ID}, user, suspended)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Lifts a suspension
+// @Description	Lets a suspended user sign in again
+// @Tags			admin
+// @Produce		json
+// @Param			userID	path		int		true	"User ID"
+// @Success		204		{string}	string	"Suspension lifted"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		404		{object}	error	"User not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/suspension	[delete]
+func (app *application) unsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	if err := app.store.Users.Unsuspend(ctx, user.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+
+	unsuspended := *user
+	unsuspended.SuspendedUntil = nil
+	unsuspended.SuspensionReason = ""
+	app.audit.Log(r, auditUserUnsuspend, AuditTarget{Type: "user", ID: user.ID}, user, unsuspended)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Signs a user out
+// @Description	Revokes every access and refresh token of the user
+// @Tags			admin
+// @Produce		json
+// @Param			userID	path		int		true	"User ID"
+// @Success		204		{string}	string	"User signed out"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		404		{object}	error	"User not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/logout	[post]
+func (app *application) forceLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	if err := app.store.RefreshTokens.DeleteByUserID(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.cacheStorage.Tokens.RevokeUser(ctx, user.ID, app.config.auth.token.exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+	app.audit.Log(r, auditUserLogout, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Deletes a user
+// @Description	Permanently deletes the user with the posts and comments of the user
+// @Tags			admin
+// @Produce		json
+// @Param			userID	path		int		true	"User ID"
+// @Success		204		{string}	string	"User deleted"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		404		{object}	error	"User not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}	[delete]
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	if err := app.store.Users.Delete(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// tokens issued before the deletion must stop working right away
+	if err := app.cacheStorage.Tokens.RevokeUser(ctx, user.ID, app.config.auth.token.exp); err != nil {
+		app.logger.Errorw("error revoking tokens of deleted user", "user", user.ID, "error", err)
+	}
+	app.deleteUserCache(ctx, user.ID)
+	app.audit.Log(r, auditUserDelete, AuditTarget{Type: "user", ID: user.ID}, user, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// adminUserContextMiddleware loads the user of the route, unlike userContextMiddleware
+// inactive users are found too
+func (app *application) adminUserContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		user, err := app.store.Users.GetAnyById(r.Context(), userID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), userCtx, user)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// requireRolePrecedence only lets users manage users whose role grants less than their own
+func (app *application) requireRolePrecedence(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor := getAuthUserFromContext(r)
+		target := getUserFromContext(r)
+		outranks, err := app.outranks(r.Context(), actor, target.Role.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !outranks {
+			app.forbiddenError(w, r, fmt.Errorf("user %d can not manage user %d of the same or a higher role", actor.ID, target.ID))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
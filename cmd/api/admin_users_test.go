@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAdminUsers(t *testing.T) {
+	app := NewTestApplication(t)
+	// user revocations last as long as the access tokens
+	app.config.auth.token.exp = time.Hour
+	mux := app.mount()
+	users := app.store.Users.(*store.MockUserStore)
+
+	// the mock store loads user 2 as a moderator and user 3 as an admin
+	tokenFor := func(t *testing.T, userID int64) string {
+		t.Helper()
+		token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"sub": userID,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not generate test token: %v", err)
+		}
+		return token
+	}
+	moderatorToken, adminToken := tokenFor(t, 2), tokenFor(t, 3)
+
+	request := func(t *testing.T, token, method, url, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should require the users.manage permission", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, tokenFor(t, 42), http.MethodGet, "/v1/admin/users", ""))
+		checkResponseCode(t, http.StatusForbidden, request(t, moderatorToken, http.MethodGet, "/v1/admin/users", ""))
+		checkResponseCode(t, http.StatusForbidden, request(t, moderatorToken, http.MethodPost, "/v1/admin/users/3/logout", ""))
+		checkResponseCode(t, http.StatusOK, request(t, adminToken, http.MethodGet, "/v1/admin/users", ""))
+	})
+	t.Run("should only manage users of a lower role", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, adminToken, http.MethodPost, "/v1/admin/users/3/logout", ""))
+		checkResponseCode(t, http.StatusForbidden, request(t, adminToken, http.MethodDelete, "/v1/admin/users/3", ""))
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodPost, "/v1/admin/users/2/logout", ""))
+	})
+	t.Run("should rank custom roles by their permissions", func(t *testing.T) {
+		// user 4 has the support role, a custom role without a level granting users.manage only
+		supportToken := tokenFor(t, 4)
+		checkResponseCode(t, http.StatusNoContent, request(t, supportToken, http.MethodPost, "/v1/admin/users/10/logout", ""))
+		checkResponseCode(t, http.StatusForbidden, request(t, supportToken, http.MethodPost, "/v1/admin/users/2/logout", ""))
+		checkResponseCode(t, http.StatusForbidden, request(t, supportToken, http.MethodPost, "/v1/admin/users/4/logout", ""))
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodPost, "/v1/admin/users/4/logout", ""))
+	})
+	t.Run("should suspend without deleting the user", func(t *testing.T) {
+		body := fmt.Sprintf(`{"reason": "spam", "expires_at": %q}`, time.Now().Add(time.Hour).Format(time.RFC3339))
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodPut, "/v1/admin/users/10/suspension", body))
+		if !slices.Contains(users.Suspended, 10) || slices.Contains(users.Deleted, 10) {
+			t.Errorf("expected user 10 to be suspended only, got suspended %v and deleted %v", users.Suspended, users.Deleted)
+		}
+		revokedAt, err := app.cacheStorage.Tokens.UserRevokedAt(context.Background(), 10)
+		if err != nil || revokedAt.IsZero() {
+			t.Errorf("expected the tokens of the suspended user to be revoked")
+		}
+	})
+	t.Run("should delete the user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodDelete, "/v1/admin/users/11", ""))
+		if !slices.Contains(users.Deleted, 11) || slices.Contains(users.Suspended, 11) {
+			t.Errorf("expected user 11 to be deleted, got deleted %v", users.Deleted)
+		}
+	})
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/Shadowcyng/goSocial/internal/ratelimiter"
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/Shadowcyng/goSocial/internal/store/cache"
+	"github.com/Shadowcyng/goSocial/internal/timeline"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
@@ -32,9 +33,14 @@ type dbConfig struct {
 }
 
 type mailConfig struct {
-	exp       time.Duration
-	apiKey    string
-	fromEmail string
+	exp           time.Duration
+	resetExp      time.Duration
+	sweepInterval time.Duration
+	// resendLimit activation emails can be resent to an address per resendWindow
+	resendLimit  int
+	resendWindow time.Duration
+	apiKey       string
+	fromEmail    string
 }
 
 type basicConfig struct {
@@ -42,13 +48,62 @@ type basicConfig struct {
 	pass string
 }
 type authConfig struct {
-	basic basicConfig
-	token tokenConfig
+	basic   basicConfig
+	token   tokenConfig
+	mfa     mfaConfig
+	lockout lockoutConfig
+	oidc    oidcConfig
+	session sessionConfig
+	// impersonation tokens let admins act as another user
+	impersonation impersonationConfig
+}
+
+type impersonationConfig struct {
+	exp time.Duration
+	// allowWrites lets impersonation tokens make state changing requests
+	allowWrites bool
+}
+
+type sessionConfig struct {
+	// cookieDomain is empty to scope the cookies to the api host
+	cookieDomain  string
+	secureCookies bool
+}
+
+type corsConfig struct {
+	// allowedOrigins are the exact origins allowed to send credentials (cookies)
+	allowedOrigins []string
+}
+
+type oidcConfig struct {
+	// provider is the name identities are stored under, the login is disabled without a client id
+	provider string
+	client   auth.OIDCConfig
+	stateExp time.Duration
+}
+
+type lockoutConfig struct {
+	// failed logins allowed per account and per ip within window before locking
+	maxAttempts   int
+	maxIPAttempts int
+	window        time.Duration
+	// lockouts start at baseDuration and double on every lockout up to maxDuration
+	baseDuration time.Duration
+	maxDuration  time.Duration
+}
+
+type mfaConfig struct {
+	// requiredLevel forces two factor authentication on roles with this level or above, 0 disables it
+	requiredLevel int
+	challengeExp  time.Duration
 }
 type tokenConfig struct {
-	secret string
-	exp    time.Duration
-	issuer string
+	secret     string
+	keysDir    string
+	activeKid  string
+	exp        time.Duration
+	refreshExp time.Duration
+	issuer     string
 }
 
 type redisConfig struct {
@@ -57,6 +112,31 @@ type redisConfig struct {
 	db      int
 	enabled bool
 }
+type feedConfig struct {
+	// cursorSecret signs the feed cursors so clients can't forge positions
+	cursorSecret string
+	timeline     timelineConfig
+}
+
+type timelineConfig struct {
+	// enabled serves the feed from timelines cached in redis, it needs redis to be enabled
+	enabled bool
+	config  timeline.Config
+}
+
+type commentConfig struct {
+	// maxDepth is how deep replies can be nested, top level comments have depth 0
+	maxDepth int
+	// threadReplies is how many replies of each thread are listed with the comments, the rest
+	// are paged from the replies endpoint
+	threadReplies int
+}
+
+type reactionConfig struct {
+	// types are the reactions users can give to posts
+	types []string
+}
+
 type config struct {
 	addr        string
 	db          dbConfig
@@ -67,7 +147,11 @@ type config struct {
 	frontendURL string
 	auth        authConfig
 	redis       redisConfig
+	cors        corsConfig
 	rateLimiter ratelimiter.Config
+	reactions   reactionConfig
+	comments    commentConfig
+	feed        feedConfig
 }
 
 type application struct {
@@ -78,40 +162,27 @@ type application struct {
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
 	rateLimiter   ratelimiter.Limiter
+	resendLimiter ratelimiter.Limiter
+	oidcProvider  *auth.OIDCProvider
+	permissions   *permissionCache
+	audit         AuditLogger
+	// timeline is nil when the timeline cache is disabled
+	timeline *timeline.Service
 }
 
-type Role struct {
-	Admin     string
-	User      string
-	Moderator string
-}
-
-var Roles = Role{Admin: "admin", User: "user", Moderator: "moderator"}
-
 func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
-	// cors handling
-	r.Use(cors.Handler(cors.Options{
-		AllowedOrigins:   []string{"https://*", "http://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
-		MaxAge:           300, // Maximum value not ignored by any of major browsers
-	}))
-
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Logger)
+	// cors handling, credentials are only allowed for the origins of the allowlist
 	r.Use(cors.Handler(cors.Options{
-		// AllowedOrigins:   []string{"https://foo.com"},
-		AllowedOrigins: []string{"https://*", "http://*"},
-		// AllowOriginFunc:  func(r *http.Request, origin string) bool { return true },
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedOrigins:   app.config.cors.allowedOrigins,
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
 		ExposedHeaders:   []string{"Link"},
-		AllowCredentials: false,
+		AllowCredentials: true,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 	r.Use(app.rateLimiterMiddleware)
@@ -120,6 +191,8 @@ func (app *application) mount() http.Handler {
 	// processing should be stopped
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	r.Get("/.well-known/jwks.json", app.jwksHandler)
+
 	r.Route("/v1", func(r chi.Router) {
 
 		// operational end points
@@ -131,34 +204,111 @@ func (app *application) mount() http.Handler {
 		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 		r.Route("/posts", func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.With(app.requireScope(scopePostsWrite)).Post("/", app.createPostHandler)
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership(Roles.Moderator, app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership(Roles.Admin, app.deletePostHandler))
-				r.Post("/commnets", app.createCommentHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Patch("/", app.checkPostOwnership(permPostsUpdateAny, app.updatePostHandler))
+				r.With(app.requireScope(scopePostsWrite)).Delete("/", app.checkPostOwnership(permPostsDeleteAny, app.deletePostHandler))
+				r.With(app.requireScope(scopeCommentsWrite)).Post("/commnets", app.createCommentHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/comments", app.getCommentsHandler)
+				r.Route("/comments/{commentID}", func(r chi.Router) {
+					r.Use(app.commentContextMiddleware)
+					r.With(app.requireScope(scopeCommentsWrite)).Patch("/", app.checkCommentOwnership(permCommentsUpdateAny, app.updateCommentHandler))
+					r.With(app.requireScope(scopeCommentsWrite)).Delete("/", app.checkCommentOwnership(permCommentsDeleteAny, app.deleteCommentHandler))
+					r.With(app.requireScope(scopePostsRead)).Get("/replies", app.getRepliesHandler)
+					r.With(app.requireScope(scopeCommentsWrite)).Post("/replies", app.createReplyHandler)
+				})
+				r.With(app.requireScope(scopeReactionsWrite)).Put("/reactions/{type}", app.reactToPostHandler)
+				r.With(app.requireScope(scopeReactionsWrite)).Delete("/reactions/{type}", app.deleteReactionHandler)
 			})
 		})
 		r.Route("/users", func(r chi.Router) {
 			r.Put("/activate/{token}", app.activateUserHandler)
+			r.Put("/email/confirm/{token}", app.confirmEmailHandler)
+			r.Route("/me", func(r chi.Router) {
+				r.Use(app.AuthTokenMiddleware)
+				r.Use(app.requireSession)
+				r.Patch("/", app.updateMeHandler)
+				r.Post("/mfa/totp", app.startTOTPHandler)
+				r.Post("/mfa/totp/verify", app.enableTOTPHandler)
+				r.Delete("/mfa/totp", app.disableTOTPHandler)
+				r.Route("/tokens", func(r chi.Router) {
+					r.Get("/", app.getPersonalAccessTokensHandler)
+					r.Post("/", app.createPersonalAccessTokenHandler)
+					r.Delete("/{tokenID}", app.deletePersonalAccessTokenHandler)
+				})
+			})
 			r.Route("/{userID}", func(r chi.Router) {
 				r.Use(app.AuthTokenMiddleware)
 				r.Use(app.userContextMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(scopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/posts", app.getUserPostsHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler)
 			})
 		})
 		r.Group(func(r chi.Router) {
 			r.Use(app.AuthTokenMiddleware)
-			r.Get("/feed", app.getUserFeedHandler)
+			r.With(app.requireScope(scopeFeedRead)).Get("/feed", app.getUserFeedHandler)
+			r.With(app.requireScope(scopePostsRead)).Get("/explore", app.getExploreHandler)
+			r.Get("/search", app.searchHandler)
+		})
+		r.Route("/tags", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.With(app.requireScope(scopePostsRead)).Get("/trending", app.getTrendingTagsHandler)
+			r.Route("/{tag}", func(r chi.Router) {
+				r.Use(app.tagContextMiddleware)
+				r.With(app.requireScope(scopePostsRead)).Get("/posts", app.getTagPostsHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/follow", app.followTagHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/unfollow", app.unfollowTagHandler)
+			})
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(app.AuthTokenMiddleware)
+			r.Use(app.requireSession)
+			r.Route("/users", func(r chi.Router) {
+				r.Use(app.RequirePermission(permUsersManage))
+				r.Get("/", app.searchUsersHandler)
+				r.Route("/{userID}", func(r chi.Router) {
+					r.Use(app.adminUserContextMiddleware)
+					r.Use(app.requireRolePrecedence)
+					r.Delete("/", app.deleteUserHandler)
+					r.Post("/unlock", app.unlockUserHandler)
+					r.With(app.RequirePermission(permUsersImpersonate)).Post("/impersonate", app.impersonateUserHandler)
+					r.Put("/role", app.assignRoleHandler)
+					r.Put("/suspension", app.suspendUserHandler)
+					r.Delete("/suspension", app.unsuspendUserHandler)
+					r.Post("/logout", app.forceLogoutHandler)
+				})
+			})
+			r.Route("/roles", func(r chi.Router) {
+				r.Use(app.RequirePermission(permRolesManage))
+				r.Get("/", app.getRolesHandler)
+				r.Post("/", app.createRoleHandler)
+				r.Put("/{roleID}/permissions", app.setRolePermissionsHandler)
+			})
+			r.With(app.RequirePermission(permRolesManage)).Get("/permissions", app.getPermissionsHandler)
+			r.With(app.RequirePermission(permAuditRead)).Get("/audit", app.getAuditEventsHandler)
 		})
 
 		// Public routes
 		r.Route("/authentication", func(r chi.Router) {
 			r.Post("/user", app.registerUserHandler)
 			r.Post("/token", app.createTokenHandler)
+			r.Post("/token/mfa", app.verifyMFAChallengeHandler)
+			r.Post("/token/mfa/enroll", app.enrollMFAChallengeHandler)
+			r.Post("/refresh", app.refreshTokenHandler)
+			r.With(app.AuthTokenMiddleware, app.requireSession).Post("/logout", app.logoutHandler)
+			r.Post("/password/forgot", app.forgotPasswordHandler)
+			r.Post("/password/reset", app.resetPasswordHandler)
+			r.Post("/activation/resend", app.resendActivationHandler)
+
+			if app.oidcProvider != nil {
+				r.Get("/oidc/authorize", app.oidcAuthorizeHandler)
+				r.Post("/oidc/callback", app.oidcCallbackHandler)
+			}
 		})
 	})
 	return r
@@ -188,6 +338,11 @@ func (app *application) run(mux http.Handler) error {
 		shutdown <- srv.Shutdown(ctx)
 	}()
 
+	// background jobs stop with the server
+	jobsCtx, cancelJobs := context.WithCancel(context.Background())
+	defer cancelJobs()
+	go app.sweepExpiredInvitations(jobsCtx, app.config.mail.sweepInterval)
+
 	app.logger.Infow("Server has start at", "addr", app.config.addr, "env", app.config.env)
 	err := srv.ListenAndServe()
 	if !errors.Is(err, http.ErrServerClosed) {
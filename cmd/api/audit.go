@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.uber.org/zap"
+)
+
+const permAuditRead = "audit.read"
+
+// audited actions
+const (
+	auditPostUpdate         = "post.update"
+	auditPostDelete         = "post.delete"
+	auditCommentUpdate      = "comment.update"
+	auditCommentDelete      = "comment.delete"
+	auditUserUnlock         = "user.unlock"
+	auditUserRoleAssign     = "user.role.assign"
+	auditUserSuspend        = "user.suspend"
+	auditUserUnsuspend      = "user.unsuspend"
+	auditUserLogout         = "user.logout"
+	auditUserDelete         = "user.delete"
+	auditUserImpersonate    = "user.impersonate"
+	auditUserPasswordChange = "user.password.change"
+	auditUserPasswordReset  = "user.password.reset"
+	auditUserMFAEnable      = "user.mfa.enable"
+	auditUserMFADisable     = "user.mfa.disable"
+	auditTokenCreate        = "token.create"
+	auditTokenDelete        = "token.delete"
+	auditRoleCreate         = "role.create"
+	auditRolePermissionsSet = "role.permissions.set"
+)
+
+// AuditTarget is the resource an audited action was applied to
+type AuditTarget struct {
+	Type string
+	ID   int64
+}
+
+// AuditLogger records privileged and security relevant actions. The actor, ip and request id
+// come from the request, before and after are diffed field by field (either can be nil)
+type AuditLogger interface {
+	Log(r *http.Request, action string, target AuditTarget, before, after any)
+}
+
+type dbAuditLogger struct {
+	store  store.Storage
+	logger *zap.SugaredLogger
+}
+
+func NewAuditLogger(s store.Storage, logger *zap.SugaredLogger) AuditLogger {
+	return &dbAuditLogger{store: s, logger: logger}
+}
+
+// Log never fails the request, events which can not be stored are written to the logs instead
+func (l *dbAuditLogger) Log(r *http.Request, action string, target AuditTarget, before, after any) {
+	event := &store.AuditEvent{
+		Action:     action,
+		TargetType: target.Type,
+		TargetID:   &target.ID,
+		IP:         clientIP(r),
+		RequestID:  middleware.GetReqID(r.Context()),
+	}
+	// while impersonating the admin is the one acting
+	if actor := getImpersonatorFromContext(r); actor != nil {
+		event.ActorID = &actor.ID
+	} else if actor := getAuthUserFromContext(r); actor != nil {
+		event.ActorID = &actor.ID
+	}
+	diff, err := auditDiff(before, after)
+	if err != nil {
+		l.logger.Errorw("error computing audit diff", "action", action, "error", err)
+	}
+	event.Diff = diff
+
+	if err := l.store.Audit.Create(r.Context(), event); err != nil {
+		l.logger.Errorw("error writing audit event", "action", action, "target", target.Type, "id", target.ID, "actor", event.ActorID, "error", err)
+	}
+}
+
+type auditChange struct {
+	From any `json:"from,omitempty"`
+	To   any `json:"to,omitempty"`
+}
+
+// auditDiff returns the fields which differ between the json forms of before and after
+func auditDiff(before, after any) (json.RawMessage, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]auditChange)
+	for k, from := range b {
+		if to, ok := a[k]; !ok || !reflect.DeepEqual(from, to) {
+			diff[k] = auditChange{From: from, To: a[k]}
+		}
+	}
+	for k, to := range a {
+		if _, ok := b[k]; !ok {
+			diff[k] = auditChange{To: to}
+		}
+	}
+	return json.Marshal(diff)
+}
+
+func auditFields(v any) (map[string]any, error) {
+	fields := make(map[string]any)
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// @Summary		Reads the audit log
+// @Description	Lists the audit events matching the filters, newest first
+// @Tags			admin
+// @Produce		json
+// @Param			limit		query		int		false	"Limit | default: 50"
+// @Param			offset		query		int		false	"Offset | default: 0"
+// @Param			actor_id	query		int		false	"User who did the action"
+// @Param			action		query		string	false	"Action, e.g. post.delete"
+// @Param			target_type	query		string	false	"Target type, e.g. post"
+// @Param			target_id	query		int		false	"Target id"
+// @Param			since		query		string	false	"From time, RFC 3339 or 2006-01-02 15:04:05 or 2006-01-02 in UTC"
+// @Param			until		query		string	false	"To time, RFC 3339 or 2006-01-02 15:04:05 or 2006-01-02 in UTC"
+// @Success		200			{object}	[]store.AuditEvent
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		403			{object}	error	"Forbidden"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/audit	[get]
+func (app *application) getAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	aq := store.PaginatedAuditQuery{
+		Limit:  50,
+		Offset: 0,
+	}
+	aq = aq.Parse(r)
+
+	if err := Validate.Struct(aq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	aq, err := aq.ResolveTimeRange()
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	events, err := app.store.Audit.List(r.Context(), aq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, events); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAudit(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	t.Run("should not allow a user without the permission to read the audit log", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/admin/audit", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should reject time filters which do not parse", func(t *testing.T) {
+		// the mock store loads user 3 as an admin
+		adminToken, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"sub": int64(3),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not generate test token: %v", err)
+		}
+		cases := map[string]int{
+			"2024-01-01T00:00:00Z": http.StatusOK,
+			"2024-01-01 00:00:00":  http.StatusOK,
+			"2024-01-01":           http.StatusOK,
+			"01/01/2024":           http.StatusBadRequest,
+			"yesterday":            http.StatusBadRequest,
+		}
+		for since, expected := range cases {
+			req, err := http.NewRequest(http.MethodGet, "/v1/admin/audit?"+url.Values{"since": {since}}.Encode(), nil)
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", adminToken))
+			rr := executeRequest(req, mux)
+			if rr.Code != expected {
+				t.Errorf("expected %d for since %q, got %d", expected, since, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should only record the changed fields", func(t *testing.T) {
+		before := store.Post{ID: 1, Title: "title", Content: "content"}
+		after := before
+		after.Content = "moderated"
+
+		data, err := auditDiff(before, after)
+		if err != nil {
+			t.Fatalf("could not diff: %v", err)
+		}
+		var diff map[string]auditChange
+		if err := json.Unmarshal(data, &diff); err != nil {
+			t.Fatalf("could not decode diff: %v", err)
+		}
+		if len(diff) != 1 || diff["content"].From != "content" || diff["content"].To != "moderated" {
+			t.Errorf("unexpected diff %s", data)
+		}
+	})
+}
@@ -1,13 +1,14 @@
 package main
 
 import (
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"net/http"
 	"time"
 
-	"github.com/Shadowcyng/goSocial/internal/mailer"
+	"github.com/Shadowcyng/goSocial/internal/auth"
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
@@ -15,7 +16,10 @@ import (
 
 type authKey string
 
-const authCtx authKey = "authUser"
+const (
+	authCtx   authKey = "authUser"
+	claimsCtx authKey = "authClaims"
+)
 
 type UserWithToken struct {
 	*store.User
@@ -27,6 +31,23 @@ type RegisterUserPayload struct {
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
 
+type TokenResponse struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresAt    int64  `json:"expires_at"`
+	// CSRFToken replaces the tokens in the cookie session mode
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+// RefreshTokenPayload is empty in the cookie session mode, the refresh token cookie is used instead
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"omitempty,max=100"`
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"omitempty,max=100"`
+}
+
 type CreateUserTokenPayload struct {
 	Email    string `json:"email" validate:"omitempty,email,max=255"`
 	Username string `json:"username" validate:"omitempty,min=3,max=50"`
@@ -70,11 +91,8 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	plainToken := uuid.New().String()
 
 	// store this in user_invitation tables after hash but keep plain token for email
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString((hash[:]))
-
 	//store the user
-	err = app.store.Users.CreateAndInvite(r.Context(), user, hashToken, app.config.mail.exp)
+	err = app.store.Users.CreateAndInvite(r.Context(), user, hashToken(plainToken), app.config.mail.exp)
 	if err != nil {
 		switch err {
 		case store.ErrorDuplicateEmail:
@@ -93,16 +111,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	// send email
-	activationURL := fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken)
-	isProdEnv := app.config.env == "production"
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      payload.Username,
-		ActivationURL: activationURL,
-	}
-	err = app.mailer.Send(mailer.UserWelcomeTemplate, payload.Username, payload.Email, vars, !isProdEnv)
+	err = app.sendActivationEmail(user, plainToken)
 	if err != nil {
 		app.logger.Errorw("error sending welcome email", "error", err)
 		// rollback user creation if email fails (SAGA pattern)
@@ -119,13 +128,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 }
 
 // @Summary		Creates a token
-// @Description	Creates a token for user
+// @Description	Creates an access token and a refresh token for user
 // @Tags			authentication
 // @Accept			json
 // @Produce		json
 // @Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-// @Success		200		{string}	string					"Token"
+// @Success		201		{object}	TokenResponse
+// @Success		200		{object}	MFAChallengeResponse	"Two factor authentication is required"
 // @Failure		400		{object}	error					"Bad request"
+// @Failure		429		{object}	error					"Too many failed attempts"
 // @Failure		500		{object}	error					"Somehting went wrong"
 // @security		ApiKeyAuth
 // @Router			/authentication/token	[post]
@@ -145,17 +156,29 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	ctx := r.Context()
+	ip := clientIP(r)
+	lockedFor, err := app.loginLockedFor(ctx, ip, nil)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if lockedFor > 0 {
+		app.accountLockedResponse(w, r, lockedFor)
+		return
+	}
+
 	// fetch the user (check if user exist) from the payload
 	var user *store.User
-	var err error
 	if payload.Email != "" {
-		user, err = app.store.Users.GetByEmail(r.Context(), payload.Email)
+		user, err = app.store.Users.GetByEmail(ctx, payload.Email)
 	} else {
-		user, err = app.store.Users.GetByUsername(r.Context(), payload.Username)
+		user, err = app.store.Users.GetByUsername(ctx, payload.Username)
 	}
 	if err != nil {
 		switch err {
 		case store.ErrorNotFound:
+			app.registerLoginFailure(ctx, ip, nil)
 			app.unauthorizedError(w, r, err)
 			return
 		default:
@@ -164,30 +187,275 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	lockedFor, err = app.loginLockedFor(ctx, ip, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if lockedFor > 0 {
+		app.accountLockedResponse(w, r, lockedFor)
+		return
+	}
+
 	err = user.Password.Validate(payload.Password)
 	if err != nil {
+		app.registerLoginFailure(ctx, ip, user)
 		app.invalidCredentials(w, r, err)
 		return
 	}
 
+	app.loginResponse(w, r, user)
+}
+
+// loginResponse sends the tokens for the authenticated user,
+// users with two factor authentication get a challenge instead of the tokens
+func (app *application) loginResponse(w http.ResponseWriter, r *http.Request, user *store.User) {
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+	if user.TOTPEnabled || app.mfaRequired(user) {
+		challenge, err := app.generateMFAChallenge(user)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if err := jsonResponse(w, http.StatusOK, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ctx := r.Context()
+	app.resetLoginFailures(ctx, user)
+	tokens, err := app.issueTokens(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens, err = app.sessionResponse(w, r, tokens)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	// send it to the client
+	if err := jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Refreshes a token
+// @Description	Exchanges a refresh token for a new access token, the refresh token is rotated
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+// @Success		201		{object}	TokenResponse
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Invalid refresh token"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/refresh	[post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// without a refresh token in the body the session cookies are used
+	cookieMode := payload.RefreshToken == ""
+	if cookieMode {
+		cookie, err := r.Cookie(refreshTokenCookie)
+		if err != nil || cookie.Value == "" {
+			app.badRequestResponse(w, r, fmt.Errorf("refresh token is missing"))
+			return
+		}
+		if err := checkCSRF(r); err != nil {
+			app.forbiddenError(w, r, err)
+			return
+		}
+		payload.RefreshToken = cookie.Value
+	}
+
+	ctx := r.Context()
+	refreshToken := uuid.New().String()
+	userID, err := app.store.RefreshTokens.Rotate(ctx, hashToken(payload.RefreshToken), hashToken(refreshToken), app.config.auth.token.refreshExp)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid refresh token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.getUser(ctx, userID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid refresh token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+
+	token, expiresAt, err := app.generateAccessToken(user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens := &TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}
+	if cookieMode {
+		// the csrf token stays the same for the whole session
+		csrf, _ := r.Cookie(csrfCookie)
+		app.setSessionCookies(w, tokens, csrf.Value)
+		tokens = &TokenResponse{ExpiresAt: expiresAt, CSRFToken: csrf.Value}
+	}
+	if err := jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Logout
+// @Description	Revokes the current access token and the given refresh token
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		LogoutPayload	false	"Refresh token"
+// @Success		204		{string}	string	"Logged out"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Unauthorized"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/authentication/logout	[post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload LogoutPayload
+	if r.ContentLength != 0 {
+		if err := readJSON(w, r, &payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getAuthUserFromContext(r)
+	if err := app.revokeAccessToken(ctx, getAuthClaimsFromContext(r)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if cookie, err := r.Cookie(refreshTokenCookie); err == nil && payload.RefreshToken == "" {
+		payload.RefreshToken = cookie.Value
+	}
+	if payload.RefreshToken != "" {
+		if err := app.store.RefreshTokens.Delete(ctx, user.ID, hashToken(payload.RefreshToken)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+	app.clearSessionCookies(w)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// issueTokens generates a short lived access token and stores a new refresh token for the user
+func (app *application) issueTokens(ctx context.Context, user *store.User) (*TokenResponse, error) {
+	token, expiresAt, err := app.generateAccessToken(user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken := uuid.New().String()
+	err = app.store.RefreshTokens.Create(ctx, user.ID, hashToken(refreshToken), app.config.auth.token.refreshExp)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresAt:    expiresAt,
+	}, nil
+}
+
+func (app *application) generateAccessToken(user *store.User) (string, int64, error) {
 	// generate the token -> add claims
+	now := time.Now()
+	exp := now.Add(app.config.auth.token.exp).Unix()
 	claims := jwt.MapClaims{
 		"sub": user.ID,
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
+		"exp": exp,
+		"iat": issuedAt(now),
+		"nbf": now.Unix(),
 		"iss": app.config.auth.token.issuer,
 		"aud": app.config.auth.token.issuer,
+		"jti": uuid.New().String(),
 	}
 
 	token, err := app.authenticator.GenerateToken(claims)
 	if err != nil {
-		app.internalServerError(w, r, err)
-		return
+		return "", 0, err
+	}
+	return token, exp, nil
+}
 
+// revokeAccessToken puts the token's jti on the denylist until the token expires
+func (app *application) revokeAccessToken(ctx context.Context, claims jwt.MapClaims) error {
+	jti, ok := claims["jti"].(string)
+	if !ok {
+		return nil
 	}
-	// send it to the client
-	if err := jsonResponse(w, http.StatusCreated, token); err != nil {
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		return err
+	}
+	return app.cacheStorage.Tokens.Revoke(ctx, jti, time.Until(exp.Time))
+}
+
+// issuedAt is the iat claim of a token issued at now. It keeps the milliseconds to tell the
+// tokens issued right after a revocation of all the user's tokens from the revoked ones
+func issuedAt(now time.Time) float64 {
+	return float64(now.UnixMilli()) / 1e3
+}
+
+func hashToken(plainToken string) string {
+	hash := sha256.Sum256([]byte(plainToken))
+	return hex.EncodeToString((hash[:]))
+}
+
+// @Summary		JSON Web Key Set
+// @Description	Public keys to verify the tokens issued by the API
+// @Tags			authentication
+// @Produce		json
+// @Success		200	{object}	auth.JWKS
+// @Failure		404	{object}	error	"Tokens are not signed with asymmetric keys"
+// @Router			/.well-known/jwks.json	[get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	publisher, ok := app.authenticator.(auth.KeyPublisher)
+	if !ok {
+		app.notFoundResponse(w, r, fmt.Errorf("authenticator has no public keys"))
+		return
+	}
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, publisher.JWKS()); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
@@ -196,3 +464,8 @@ func getAuthUserFromContext(r *http.Request) *store.User {
 	user, _ := r.Context().Value(authCtx).(*store.User)
 	return user
 }
+
+func getAuthClaimsFromContext(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(claimsCtx).(jwt.MapClaims)
+	return claims
+}
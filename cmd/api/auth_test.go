@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+func TestRefreshTokens(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.token.exp = time.Hour
+	app.config.auth.token.refreshExp = time.Hour
+	mux := app.mount()
+
+	// the mock store loads every user as the zero user, whose tokens these are
+	tokens, err := app.issueTokens(context.Background(), &store.User{})
+	if err != nil {
+		t.Fatalf("could not issue tokens: %v", err)
+	}
+
+	newRequest := func(t *testing.T, method, url, body string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		return req
+	}
+	refresh := func(t *testing.T, refreshToken string) *httptest.ResponseRecorder {
+		t.Helper()
+		body := fmt.Sprintf(`{"refresh_token": %q}`, refreshToken)
+		return executeRequest(newRequest(t, http.MethodPost, "/v1/authentication/refresh", body), mux)
+	}
+
+	var rotated TokenResponse
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		rr := refresh(t, tokens.RefreshToken)
+		checkResponseCode(t, http.StatusCreated, rr.Code)
+
+		var response struct {
+			Data TokenResponse `json:"data"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+			t.Fatalf("could not decode response: %v", err)
+		}
+		rotated = response.Data
+		if rotated.Token == "" || rotated.RefreshToken == "" || rotated.RefreshToken == tokens.RefreshToken {
+			t.Errorf("expected new tokens, got %+v", rotated)
+		}
+	})
+	t.Run("should reject a rotated refresh token", func(t *testing.T) {
+		checkResponseCode(t, http.StatusUnauthorized, refresh(t, tokens.RefreshToken).Code)
+	})
+	t.Run("should reject a revoked access token", func(t *testing.T) {
+		getUser := func(t *testing.T) int {
+			t.Helper()
+			req := newRequest(t, http.MethodGet, "/v1/users/1", "")
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rotated.Token))
+			return executeRequest(req, mux).Code
+		}
+		checkResponseCode(t, http.StatusOK, getUser(t))
+
+		body := fmt.Sprintf(`{"refresh_token": %q}`, rotated.RefreshToken)
+		req := newRequest(t, http.MethodPost, "/v1/authentication/logout", body)
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rotated.Token))
+		checkResponseCode(t, http.StatusNoContent, executeRequest(req, mux).Code)
+
+		checkResponseCode(t, http.StatusUnauthorized, getUser(t))
+		checkResponseCode(t, http.StatusUnauthorized, refresh(t, rotated.RefreshToken).Code)
+	})
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
 )
 
+type commentKey string
+
+const commentCtx commentKey = "comment"
+
 type CreateCommentPayload struct {
 	UserId  int64       `json:"user_id" validate:"required"`
 	User    *store.User `json:"user" validate:"required"`
@@ -31,3 +40,304 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 	}
 	jsonResponse(w, http.StatusCreated, comment)
 }
+
+// CommentPage is a page of top level comments with their replies
+type CommentPage struct {
+	Comments []store.Comment `json:"comments"`
+	// NextCursor is passed as cursor to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+func defaultCommentQuery() store.PaginatedCommentQuery {
+	return store.PaginatedCommentQuery{
+		Limit: 20,
+		Sort:  "newest",
+		View:  "flat",
+	}
+}
+
+// @Summary		Lists comments
+// @Description	Lists the top level comments of a post a page at a time, each followed by the first replies
+// @Description	of its thread. Threads with more replies have a replies_cursor for the replies endpoint
+// @Tags			comments
+// @Produce		json
+// @Param			postID	path		int		true	"Post id"
+// @Param			limit	query		int		false	"Limit | default: 20"
+// @Param			sort	query		string	false	"newest, oldest or top | default: newest"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Param			view	query		string	false	"Replies flattened with depth (flat) or nested (tree) | default: flat"
+// @Success		200		{object}	CommentPage
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		404		{object}	error	"Post not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/comments	[get]
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	cq := defaultCommentQuery().Parse(r)
+	if err := Validate.Struct(cq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	page, err := app.commentPage(r.Context(), getPostFromContext(r).ID, cq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// commentPage loads a page of top level comments and lays out their replies as the query asks
+func (app *application) commentPage(ctx context.Context, postID int64, cq store.PaginatedCommentQuery) (*CommentPage, error) {
+	comments, next, err := app.store.Comments.List(ctx, postID, cq)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+	replies, cursors, err := app.store.Comments.GetReplies(ctx, ids, app.config.comments.threadReplies)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].RepliesCursor = cursors[comments[i].ID]
+	}
+
+	if cq.View == "tree" {
+		comments = store.NestReplies(comments, replies)
+	} else {
+		comments = store.FlattenThreads(comments, replies)
+	}
+	return &CommentPage{Comments: comments, NextCursor: next}, nil
+}
+
+// ReplyPage is a page of the replies below a comment in thread order, their parent_id and depth
+// tell how they nest
+type ReplyPage struct {
+	Replies []store.Comment `json:"replies"`
+	// NextCursor is passed as cursor to get the next page, empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// @Summary		Lists replies
+// @Description	Lists the replies below a comment a page at a time in thread order, the first page
+// @Description	starts at the replies_cursor of a listed comment or at the first reply without a cursor
+// @Tags			comments
+// @Produce		json
+// @Param			postID		path		int		true	"Post id"
+// @Param			commentID	path		int		true	"Comment id"
+// @Param			limit		query		int		false	"Limit | default: 20"
+// @Param			cursor		query		string	false	"next_cursor of the previous page or replies_cursor of the comment"
+// @Success		200			{object}	ReplyPage
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		404			{object}	error	"Comment not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/comments/{commentID}/replies	[get]
+func (app *application) getRepliesHandler(w http.ResponseWriter, r *http.Request) {
+	rq := store.PaginatedReplyQuery{Limit: 20}.Parse(r)
+	if err := Validate.Struct(rq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	replies, next, err := app.store.Comments.GetThreadReplies(r.Context(), getCommentFromContext(r).ID, rq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, ReplyPage{Replies: replies, NextCursor: next}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type CreateReplyPayload struct {
+	Content string `json:"content" validate:"required,max=500"`
+}
+
+// @Summary		Replies to a comment
+// @Description	Creates a reply by the authenticated user, replies can be nested up to the configured depth
+// @Tags			comments
+// @Accept			json
+// @Produce		json
+// @Param			postID		path		int					true	"Post id"
+// @Param			commentID	path		int					true	"Comment id"
+// @Param			payload		body		CreateReplyPayload	true	"Reply content"
+// @Success		201			{object}	store.Comment
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		404			{object}	error	"Comment not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/comments/{commentID}/replies	[post]
+func (app *application) createReplyHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateReplyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	parent := getCommentFromContext(r)
+	if parent.RemovedAt != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("comment has been removed"))
+		return
+	}
+	if parent.Depth >= app.config.comments.maxDepth {
+		app.badRequestResponse(w, r, fmt.Errorf("replies can not be nested deeper than %d", app.config.comments.maxDepth))
+		return
+	}
+	user := getAuthUserFromContext(r)
+	reply := store.Comment{
+		PostID:   parent.PostID,
+		UserID:   user.ID,
+		Content:  payload.Content,
+		ParentID: &parent.ID,
+		Depth:    parent.Depth + 1,
+		User:     *user,
+	}
+	if err := app.store.Comments.Create(r.Context(), &reply); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusCreated, reply); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type UpdateCommentPayload struct {
+	Content string `json:"content" validate:"required,max=500"`
+}
+
+// @Summary		Edits a comment
+// @Description	Changes the content of a comment of the authenticated user, moderators and admins can
+// @Description	edit the comments of other users. The comment is marked as edited
+// @Tags			comments
+// @Accept			json
+// @Produce		json
+// @Param			postID		path		int						true	"Post id"
+// @Param			commentID	path		int						true	"Comment id"
+// @Param			payload		body		UpdateCommentPayload	true	"Comment content"
+// @Success		200			{object}	store.Comment
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		403			{object}	error	"Forbidden"
+// @Failure		404			{object}	error	"Comment not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/comments/{commentID}	[patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment := getCommentFromContext(r)
+	before := *comment
+	comment.Content = payload.Content
+	if err := app.store.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if getAuthUserFromContext(r).ID != comment.UserID {
+		app.audit.Log(r, auditCommentUpdate, AuditTarget{Type: "comment", ID: comment.ID}, before, comment)
+	}
+	if err := jsonResponse(w, http.StatusOK, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Deletes a comment
+// @Description	Deletes a comment of the authenticated user. Comments with replies and comments
+// @Description	deleted by moderators are left as a "[removed]" tombstone
+// @Tags			comments
+// @Produce		json
+// @Param			postID		path		int		true	"Post id"
+// @Param			commentID	path		int		true	"Comment id"
+// @Success		204			{string}	string	"Comment deleted"
+// @Failure		403			{object}	error	"Forbidden"
+// @Failure		404			{object}	error	"Comment not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/comments/{commentID}	[delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromContext(r)
+	moderated := getAuthUserFromContext(r).ID != comment.UserID
+
+	var err error
+	if moderated {
+		err = app.store.Comments.Remove(r.Context(), comment.ID)
+	} else {
+		err = app.store.Comments.Delete(r.Context(), comment.ID)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if moderated {
+		app.audit.Log(r, auditCommentDelete, AuditTarget{Type: "comment", ID: comment.ID}, comment, nil)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// commentContextMiddleware loads the comment of the route, it has to belong to the post of the route
+func (app *application) commentContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		commentID, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		comment, err := app.store.Comments.GetById(r.Context(), commentID)
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		if comment.PostID != getPostFromContext(r).ID {
+			app.notFoundResponse(w, r, store.ErrorNotFound)
+			return
+		}
+		ctx := context.WithValue(r.Context(), commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getCommentFromContext(r *http.Request) *store.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*store.Comment)
+	return comment
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCommentReplies(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	reply := func(t *testing.T, url string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"content": "reply"}`))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should reply to a comment of the post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, reply(t, "/v1/posts/1/comments/10/replies"))
+	})
+	t.Run("should not find a comment of another post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNotFound, reply(t, "/v1/posts/2/comments/10/replies"))
+	})
+	t.Run("should not nest replies deeper than the max depth", func(t *testing.T) {
+		app.config.comments.maxDepth = 0
+		checkResponseCode(t, http.StatusBadRequest, reply(t, "/v1/posts/1/comments/10/replies"))
+	})
+}
+
+func TestCommentModeration(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	// the mock comments are written by the user with the id of the comment
+	newRequest := func(t *testing.T, method, url string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(`{"content": "edited"}`))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return req
+	}
+
+	t.Run("should allow the author to edit the comment", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPatch, "/v1/posts/1/comments/0"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+	t.Run("should allow the author to delete the comment", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodDelete, "/v1/posts/1/comments/0"), mux)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+	})
+	t.Run("should not allow other users without permission to delete the comment", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodDelete, "/v1/posts/1/comments/10"), mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+func TestListComments(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	list := func(t *testing.T, url string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should list the comments of the post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, list(t, "/v1/posts/1/comments?sort=top&view=tree"))
+	})
+	t.Run("should reject an unknown sort", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, list(t, "/v1/posts/1/comments?sort=random"))
+	})
+	t.Run("should embed the first page in the post", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, list(t, "/v1/posts/1"))
+	})
+	t.Run("should page the replies of a thread", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, list(t, "/v1/posts/1/comments/10/replies?limit=5"))
+		checkResponseCode(t, http.StatusBadRequest, list(t, "/v1/posts/1/comments/10/replies?cursor=invalid"))
+		checkResponseCode(t, http.StatusBadRequest, list(t, "/v1/posts/1/comments/10/replies?limit=500"))
+		checkResponseCode(t, http.StatusNotFound, list(t, "/v1/posts/2/comments/10/replies"))
+	})
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"fmt"
+	"math"
 	"net/http"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
 )
 
 func (app *application) internalServerError(w http.ResponseWriter, r *http.Request, err error) {
@@ -49,3 +53,14 @@ func (app *application) rateLimitExceededResponse(w http.ResponseWriter, r *http
 	w.Header().Set("Retry-After", retryAfter)
 	writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit exceeded , retry after %s", retryAfter))
 }
+
+func (app *application) accountLockedResponse(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	app.logger.Warnw("login locked", "method", r.Method, "path", r.URL.Path)
+	w.Header().Set("Retry-After", fmt.Sprintf("%.f", math.Ceil(retryAfter.Seconds())))
+	writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("too many failed login attempts, retry after %s", retryAfter.Round(time.Second)))
+}
+
+func (app *application) accountSuspendedResponse(w http.ResponseWriter, r *http.Request, user *store.User) {
+	app.logger.Warnw("suspended account", "method", r.Method, "path", r.URL.Path, "user", user.ID)
+	writeJSONError(w, http.StatusForbidden, fmt.Sprintf("account is suspended until %s: %s", user.SuspendedUntil.Format(time.RFC3339), user.SuspensionReason))
+}
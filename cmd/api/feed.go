@@ -1,28 +1,166 @@
 package main
 
 import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
 )
 
+// FeedPage is the feed returned in keyset mode
+type FeedPage struct {
+	Data []*store.PostWithMetadata `json:"data"`
+	// NextCursor and PrevCursor are passed as cursor to get the pages around this one,
+	// they are empty at the ends of the feed
+	NextCursor string `json:"next_cursor"`
+	PrevCursor string `json:"prev_cursor"`
+}
+
 // @Summary		get feed
-// @Description	get user feed by its followers or own
+// @Description	get user feed by its followers or own. Passing cursor (empty for the first page) pages by
+// @Description	cursor and returns a FeedPage, otherwise the feed is paged by offset and returned as a list
 // @Tags			feed
 // @Accept			json
 // @Produce		json
 // @Param			limit		query		int		false	"Feed limit  | default: 20"
 // @Param			offset		query		int		false	"Feed offset | default: 0"
-// @Param			sort_by		query		string	false	"Feed sort_by | default : created_at"
+// @Param			cursor		query		string	false	"next_cursor or prev_cursor of a page"
+// @Param			sort_by		query		string	false	"Feed sort_by (title/content/created_at/popular) | default : created_at"
 // @Param			sort_order	query		string	false	"Feed sort_order(asc/desc) | default | desc"
 // @Param			tags		query		string	false	"Feed tag comma seprated string | max: 5 "
 // @Param			search		query		string	false	"Feed search by title/content  "
+// @Param			since		query		string	false	"From time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			until		query		string	false	"To time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			tz			query		string	false	"Time zone of times without an offset, e.g. Europe/Berlin | default: UTC"
+// @Param			ranking		query		string	false	"Rank the feed (chronological/engagement/affinity) instead of sorting it, paged by offset"
 // @Success		200			{object}	[]store.PostWithMetadata
+// @Success		200			{object}	FeedPage
 // @Failure		400			{object}	error	"Bad request"
 // @Failure		500			{object}	error	"Somehting went wrong"
 // @security		ApiKeyAuth
 // @Router			/feed	[get]
 func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	userID := getAuthUserFromContext(r).ID
+	if fq.Ranking != "" {
+		if fq.Keyset {
+			app.badRequestResponse(w, r, errRankedFeedCursor)
+			return
+		}
+		feeds, err := app.store.Posts.GetRankedFeed(r.Context(), userID, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		app.feedResponse(w, r, fq, feeds, nil)
+		return
+	}
+	if app.useTimeline(fq) {
+		feeds, ok, err := app.timelineFeed(r.Context(), userID, fq)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if ok {
+			if err = jsonResponse(w, http.StatusOK, feeds); err != nil {
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+	}
+	feeds, cursors, err := app.store.Posts.GetUserFeed(r.Context(), userID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, fq, feeds, cursors)
+}
+
+// @Summary		get user posts
+// @Description	get the profile timeline of a user, paged and filtered like the feed
+// @Tags			feed
+// @Accept			json
+// @Produce		json
+// @Param			userID		path		int		true	"User ID"
+// @Param			limit		query		int		false	"Feed limit  | default: 20"
+// @Param			offset		query		int		false	"Feed offset | default: 0"
+// @Param			cursor		query		string	false	"next_cursor or prev_cursor of a page"
+// @Param			sort_by		query		string	false	"Feed sort_by (title/content/created_at/popular) | default : created_at"
+// @Param			sort_order	query		string	false	"Feed sort_order(asc/desc) | default | desc"
+// @Param			tags		query		string	false	"Feed tag comma seprated string | max: 5 "
+// @Param			search		query		string	false	"Feed search by title/content  "
+// @Param			since		query		string	false	"From time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			until		query		string	false	"To time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			tz			query		string	false	"Time zone of times without an offset, e.g. Europe/Berlin | default: UTC"
+// @Success		200			{object}	[]store.PostWithMetadata
+// @Success		200			{object}	FeedPage
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		404			{object}	error	"User not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/{userID}/posts	[get]
+func (app *application) getUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	author := getUserFromContext(r)
+	feeds, cursors, err := app.store.Posts.GetUserPosts(r.Context(), getAuthUserFromContext(r).ID, author.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, fq, feeds, cursors)
+}
+
+// @Summary		explore
+// @Description	get the recent (sort_by=created_at) or popular (sort_by=popular) posts of every user,
+// @Description	paged and filtered like the feed
+// @Tags			feed
+// @Accept			json
+// @Produce		json
+// @Param			limit		query		int		false	"Feed limit  | default: 20"
+// @Param			offset		query		int		false	"Feed offset | default: 0"
+// @Param			cursor		query		string	false	"next_cursor or prev_cursor of a page"
+// @Param			sort_by		query		string	false	"Feed sort_by (title/content/created_at/popular) | default : created_at"
+// @Param			sort_order	query		string	false	"Feed sort_order(asc/desc) | default | desc"
+// @Param			tags		query		string	false	"Feed tag comma seprated string | max: 5 "
+// @Param			search		query		string	false	"Feed search by title/content  "
+// @Param			since		query		string	false	"From time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			until		query		string	false	"To time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			tz			query		string	false	"Time zone of times without an offset, e.g. Europe/Berlin | default: UTC"
+// @Success		200			{object}	[]store.PostWithMetadata
+// @Success		200			{object}	FeedPage
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/explore	[get]
+func (app *application) getExploreHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	feeds, cursors, err := app.store.Posts.GetExploreFeed(r.Context(), getAuthUserFromContext(r).ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, fq, feeds, cursors)
+}
+
+// readFeedQuery parses and validates the feed query of the request with the position of its
+// cursor, it writes the error response and reports false when the query is invalid
+func (app *application) readFeedQuery(w http.ResponseWriter, r *http.Request) (store.PaginatedFeedQuery, bool) {
 	fq := store.PaginatedFeedQuery{
 		Limit:     20,
 		Offset:    0,
@@ -35,15 +173,156 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 
 	if err := Validate.Struct(fq); err != nil {
 		app.badRequestResponse(w, r, err)
-		return
+		return fq, false
 	}
-	feeds, err := app.store.Posts.GetUserFeed(r.Context(), int64(1), fq)
+	fq, err := fq.ResolveTimeRange(time.Now())
 	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return fq, false
+	}
+	if fq.Cursor != "" {
+		pos, err := app.decodeFeedCursor(fq.Cursor)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return fq, false
+		}
+		// a cursor only points into the feed sorted the way it was made for
+		if pos.SortBy != fq.SortBy || pos.SortOrder != fq.SortOrder {
+			app.badRequestResponse(w, r, errInvalidFeedCursor)
+			return fq, false
+		}
+		fq.Position = pos
+	}
+	return fq, true
+}
+
+// feedResponse writes the feed as a list in offset mode and as a FeedPage in keyset mode
+func (app *application) feedResponse(w http.ResponseWriter, r *http.Request, fq store.PaginatedFeedQuery, feeds []*store.PostWithMetadata, cursors *store.FeedCursors) {
+	var err error
+	if !fq.Keyset {
+		if err = jsonResponse(w, http.StatusOK, feeds); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	page := FeedPage{Data: feeds}
+	if page.NextCursor, err = app.encodeFeedCursor(cursors.Next); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	if err = jsonResponse(w, http.StatusOK, feeds); err != nil {
+	if page.PrevCursor, err = app.encodeFeedCursor(cursors.Prev); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if err = jsonResponse(w, http.StatusOK, page); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// useTimeline reports whether the feed can be served from the timeline cache, which only knows
+// the latest posts of the feed and pages by offset
+func (app *application) useTimeline(fq store.PaginatedFeedQuery) bool {
+	return app.timeline != nil &&
+		!fq.Keyset &&
+		fq.SortBy == "created_at" &&
+		fq.SortOrder == "desc" &&
+		len(fq.Tags) == 0 &&
+		fq.Search == "" &&
+		fq.Since == "" &&
+		fq.Until == ""
+}
+
+// timelineFeed reads the page from the cached timeline of the user, it reports false when the
+// page is beyond the cached part of the timeline
+func (app *application) timelineFeed(ctx context.Context, userID int64, fq store.PaginatedFeedQuery) ([]*store.PostWithMetadata, bool, error) {
+	ids, ok, err := app.timeline.Read(ctx, userID, fq.Offset, fq.Limit)
+	if err != nil || !ok {
+		return nil, ok, err
+	}
+	feeds, err := app.store.Posts.GetFeedByIDs(ctx, userID, ids)
+	if err != nil {
+		return nil, false, err
+	}
+	return feeds, true, nil
+}
+
+// fanOutPost pushes a new post to the cached timelines in the background, a failed push leaves
+// the post out of the timelines until they are rebuilt
+func (app *application) fanOutPost(post store.Post) {
+	if app.timeline == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err := app.timeline.FanOut(ctx, &post); err != nil {
+			app.logger.Errorw("error fanning out post", "post", post.ID, "user", post.UserID, "error", err)
+		}
+	}()
+}
+
+// removePost drops a deleted post from the cached timelines in the background, a failed removal
+// leaves the timelines a post short until they are rebuilt
+func (app *application) removePost(post store.Post) {
+	if app.timeline == nil {
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		defer cancel()
+		if err := app.timeline.Remove(ctx, &post); err != nil {
+			app.logger.Errorw("error removing post from timelines", "post", post.ID, "user", post.UserID, "error", err)
+		}
+	}()
+}
+
+// invalidateTimeline drops the cached timeline of the user after the followed users changed
+func (app *application) invalidateTimeline(ctx context.Context, userID int64) {
+	if app.timeline == nil {
+		return
+	}
+	if err := app.timeline.Invalidate(ctx, userID); err != nil {
+		app.logger.Errorw("error invalidating timeline", "user", userID, "error", err)
+	}
+}
+
+var (
+	errInvalidFeedCursor = errors.New("invalid cursor")
+	errRankedFeedCursor  = errors.New("ranked feeds are paged by offset")
+)
+
+// encodeFeedCursor signs the position as <payload>.<signature>, nil positions give an empty cursor
+func (app *application) encodeFeedCursor(pos *store.FeedPosition) (string, error) {
+	if pos == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(pos)
+	if err != nil {
+		return "", err
+	}
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + app.signFeedCursor(payload), nil
+}
+
+func (app *application) decodeFeedCursor(cursor string) (*store.FeedPosition, error) {
+	payload, signature, ok := strings.Cut(cursor, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(app.signFeedCursor(payload))) {
+		return nil, errInvalidFeedCursor
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidFeedCursor
+	}
+	var pos store.FeedPosition
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return nil, errInvalidFeedCursor
+	}
+	return &pos, nil
+}
+
+func (app *application) signFeedCursor(payload string) string {
+	mac := hmac.New(sha256.New, []byte(app.config.feed.cursorSecret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
 }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+func TestFeedCursor(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	getFeed := func(t *testing.T, query string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/v1/feed?"+query, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	cursor, err := app.encodeFeedCursor(&store.FeedPosition{SortBy: "created_at", SortOrder: "desc", Key: "2024-01-01T00:00:00Z", ID: 10})
+	if err != nil {
+		t.Fatalf("could not encode cursor: %v", err)
+	}
+
+	t.Run("should decode the cursors it signed", func(t *testing.T) {
+		pos, err := app.decodeFeedCursor(cursor)
+		if err != nil {
+			t.Fatalf("could not decode cursor: %v", err)
+		}
+		if pos.ID != 10 || pos.Key != "2024-01-01T00:00:00Z" {
+			t.Errorf("unexpected position %+v", pos)
+		}
+	})
+	t.Run("should page by cursor", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, getFeed(t, "cursor="))
+		checkResponseCode(t, http.StatusOK, getFeed(t, "cursor="+cursor))
+	})
+	t.Run("should page by the cursor of the longest content", func(t *testing.T) {
+		// json escapes < as \u003c, the longest encoding of a character
+		content, err := app.encodeFeedCursor(&store.FeedPosition{SortBy: "content", SortOrder: "desc", Key: strings.Repeat("<", 1000), ID: 10})
+		if err != nil {
+			t.Fatalf("could not encode cursor: %v", err)
+		}
+		checkResponseCode(t, http.StatusOK, getFeed(t, "sort_by=content&cursor="+content))
+	})
+	t.Run("should reject a tampered cursor", func(t *testing.T) {
+		payload, signature, _ := strings.Cut(cursor, ".")
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "cursor="+payload+"x."+signature))
+	})
+	t.Run("should reject a cursor of another sort", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "sort_order=asc&cursor="+cursor))
+	})
+	t.Run("should filter by time range", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, getFeed(t, "since=24h&until=2030-01-01T00:00:00Z"))
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "since=yesterday"))
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "since=1h&until=2d"))
+	})
+	t.Run("should rank the feed", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, getFeed(t, "ranking=engagement&offset=20"))
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "ranking=random"))
+		checkResponseCode(t, http.StatusBadRequest, getFeed(t, "ranking=affinity&cursor="))
+	})
+}
+
+func TestTimelines(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	get := func(t *testing.T, path string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should list the posts of a user", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, get(t, "/v1/users/2/posts?tags=go&search=hello"))
+		checkResponseCode(t, http.StatusOK, get(t, "/v1/users/2/posts?cursor="))
+	})
+	t.Run("should list the recent and popular posts", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, get(t, "/v1/explore"))
+		checkResponseCode(t, http.StatusOK, get(t, "/v1/explore?sort_by=popular&cursor="))
+	})
+	t.Run("should reject an unknown sort", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, get(t, "/v1/explore?sort_by=random"))
+	})
+}
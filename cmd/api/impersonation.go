@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const impersonatorCtx authKey = "impersonator"
+
+// @Summary		Impersonates a user
+// @Description	Issues a short lived access token to act as the user. The token has no refresh token,
+// @Description	carries the admin in the act claim and only allows reads unless configured otherwise
+// @Tags			admin
+// @Produce		json
+// @Param			userID	path		int		true	"User ID"
+// @Success		201		{object}	TokenResponse
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		404		{object}	error	"User not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/impersonate	[post]
+func (app *application) impersonateUserHandler(w http.ResponseWriter, r *http.Request) {
+	actor := getAuthUserFromContext(r)
+	user := getUserFromContext(r)
+	if !user.IsActive {
+		app.badRequestResponse(w, r, fmt.Errorf("user %d is not active", user.ID))
+		return
+	}
+
+	token, expiresAt, err := app.generateImpersonationToken(actor, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.audit.Log(r, auditUserImpersonate, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	if err := jsonResponse(w, http.StatusCreated, TokenResponse{Token: token, ExpiresAt: expiresAt}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// generateImpersonationToken issues an access token for user with the actor in the act claim (RFC 8693)
+func (app *application) generateImpersonationToken(actor, user *store.User) (string, int64, error) {
+	now := time.Now()
+	exp := now.Add(app.config.auth.impersonation.exp).Unix()
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"act": map[string]any{"sub": actor.ID},
+		"exp": exp,
+		"iat": issuedAt(now),
+		"nbf": now.Unix(),
+		"iss": app.config.auth.token.issuer,
+		"aud": app.config.auth.token.issuer,
+		"jti": uuid.New().String(),
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, exp, nil
+}
+
+// impersonate adds the actor of an impersonation token to ctx, the error response is written when
+// it returns false. The actor has to be able to sign in still, and while impersonating only reads
+// are allowed unless configured otherwise
+func (app *application) impersonate(w http.ResponseWriter, r *http.Request, ctx context.Context, user *store.User, act any) (context.Context, bool) {
+	claims, ok := act.(map[string]any)
+	if !ok {
+		app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		return nil, false
+	}
+	actorID, err := userIDFromClaims(claims)
+	if err != nil {
+		app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		return nil, false
+	}
+	actor, err := app.getUser(ctx, actorID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return nil, false
+	}
+	if actor.IsSuspended() {
+		app.unauthorizedError(w, r, fmt.Errorf("impersonating user %d is suspended", actor.ID))
+		return nil, false
+	}
+	if !isSafeMethod(r.Method) && !app.config.auth.impersonation.allowWrites {
+		app.forbiddenError(w, r, fmt.Errorf("%s is not allowed while impersonating", r.Method))
+		return nil, false
+	}
+
+	app.logger.Infow("impersonated request",
+		"actor", actor.ID,
+		"user", user.ID,
+		"method", r.Method,
+		"path", r.URL.Path,
+		"request_id", middleware.GetReqID(ctx),
+	)
+	return context.WithValue(ctx, impersonatorCtx, actor), true
+}
+
+// getImpersonatorFromContext returns the admin acting as the authenticated user, nil outside of impersonation
+func getImpersonatorFromContext(r *http.Request) *store.User {
+	user, _ := r.Context().Value(impersonatorCtx).(*store.User)
+	return user
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestImpersonation(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+		"sub": int64(42),
+		"act": map[string]any{"sub": int64(7)},
+		"exp": time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	t.Run("should allow reads while impersonating", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/10", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should block state changes while impersonating", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(`{"username": "new_name"}`))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should reject a malformed act claim", func(t *testing.T) {
+		token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"sub": int64(42),
+			"act": "7",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not generate test token: %v", err)
+		}
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/10", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+	})
+}
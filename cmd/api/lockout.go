@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+// @Summary		Unlock user
+// @Description	Clears the login lockout and failed attempts of a user
+// @Tags			admin
+// @Produce		json
+// @Param			userID	path		int		true	"User ID"
+// @Success		204		{string}	string	"User unlocked"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		404		{object}	error	"User not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/unlock	[post]
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+	if err := app.cacheStorage.LoginAttempts.Unlock(r.Context(), accountLockKey(user.ID)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteUserCache(r.Context(), user.ID)
+	app.audit.Log(r, auditUserUnlock, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// loginLockedFor returns how long logins are still locked for the ip, and the user when given
+func (app *application) loginLockedFor(ctx context.Context, ip string, user *store.User) (time.Duration, error) {
+	lockedFor, err := app.cacheStorage.LoginAttempts.LockedFor(ctx, ipLockKey(ip))
+	if err != nil || user == nil {
+		return lockedFor, err
+	}
+	accountLockedFor, err := app.cacheStorage.LoginAttempts.LockedFor(ctx, accountLockKey(user.ID))
+	if err != nil {
+		return 0, err
+	}
+	return max(lockedFor, accountLockedFor), nil
+}
+
+// registerLoginFailure counts a failed login against the ip and the user (when the account exists)
+// and locks them once they go over the allowed attempts
+func (app *application) registerLoginFailure(ctx context.Context, ip string, user *store.User) {
+	cfg := app.config.auth.lockout
+	if _, err := app.registerFailure(ctx, ipLockKey(ip), cfg.maxIPAttempts); err != nil {
+		app.logger.Errorw("error registering login failure", "ip", ip, "error", err)
+	}
+	if user == nil {
+		return
+	}
+	lockedFor, err := app.registerFailure(ctx, accountLockKey(user.ID), cfg.maxAttempts)
+	if err != nil {
+		app.logger.Errorw("error registering login failure", "user", user.ID, "error", err)
+		return
+	}
+	if lockedFor == 0 {
+		return
+	}
+
+	app.logger.Warnw("account locked", "user", user.ID, "ip", ip, "duration", lockedFor.String())
+	vars := struct {
+		Username  string
+		LockedFor string
+		ResetURL  string
+	}{
+		Username:  user.Username,
+		LockedFor: lockedFor.String(),
+		ResetURL:  fmt.Sprintf("%s/forgot-password", app.config.frontendURL),
+	}
+	isProdEnv := app.config.env == "production"
+	if err := app.mailer.Send(mailer.AccountLockedTemplate, user.Username, user.Email, vars, !isProdEnv); err != nil {
+		app.logger.Errorw("error sending account locked email", "error", err)
+	}
+}
+
+// registerFailure returns the lock duration when the failure locked the key, 0 otherwise
+func (app *application) registerFailure(ctx context.Context, key string, maxAttempts int) (time.Duration, error) {
+	cfg := app.config.auth.lockout
+	failures, err := app.cacheStorage.LoginAttempts.Fail(ctx, key, cfg.window)
+	if err != nil || failures < int64(maxAttempts) {
+		return 0, err
+	}
+
+	lockouts, err := app.cacheStorage.LoginAttempts.IncrLockouts(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	lockedFor := lockoutDuration(cfg.baseDuration, cfg.maxDuration, lockouts)
+	if err := app.cacheStorage.LoginAttempts.Lock(ctx, key, lockedFor); err != nil {
+		return 0, err
+	}
+	// the next lock needs a new round of failures
+	if err := app.cacheStorage.LoginAttempts.Reset(ctx, key); err != nil {
+		return 0, err
+	}
+	return lockedFor, nil
+}
+
+// resetLoginFailures clears the failed attempts of the user after a successful login
+func (app *application) resetLoginFailures(ctx context.Context, user *store.User) {
+	if err := app.cacheStorage.LoginAttempts.Reset(ctx, accountLockKey(user.ID)); err != nil {
+		app.logger.Errorw("error resetting login failures", "user", user.ID, "error", err)
+	}
+}
+
+// lockoutDuration doubles base for every previous lockout, capped at maxDuration
+func lockoutDuration(base, maxDuration time.Duration, lockouts int64) time.Duration {
+	d := base
+	for i := int64(1); i < lockouts; i++ {
+		d *= 2
+		if d >= maxDuration {
+			return maxDuration
+		}
+	}
+	return min(d, maxDuration)
+}
+
+func accountLockKey(userID int64) string {
+	return fmt.Sprintf("user:%d", userID)
+}
+
+func ipLockKey(ip string) string {
+	return fmt.Sprintf("ip:%s", ip)
+}
+
+// clientIP strips the port from the remote address, RealIP middleware has already resolved proxies
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
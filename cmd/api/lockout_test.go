@@ -0,0 +1,65 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		lockouts int64
+		want     time.Duration
+	}{
+		{name: "first lockout is the base", lockouts: 1, want: time.Minute},
+		{name: "second lockout doubles", lockouts: 2, want: 2 * time.Minute},
+		{name: "fourth lockout doubles three times", lockouts: 4, want: 8 * time.Minute},
+		{name: "reaching the cap", lockouts: 5, want: 10 * time.Minute},
+		{name: "past the cap", lockouts: 50, want: 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := lockoutDuration(time.Minute, 10*time.Minute, tt.lockouts); got != tt.want {
+				t.Errorf("expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.lockout = lockoutConfig{
+		maxAttempts:   3,
+		maxIPAttempts: 50,
+		window:        time.Minute,
+		baseDuration:  time.Minute,
+		maxDuration:   time.Hour,
+	}
+	mux := app.mount()
+
+	// the mock users have no password, every login fails
+	login := func(t *testing.T) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", strings.NewReader(`{"email": "user@example.com", "password": "wrong"}`))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	for i := 0; i < 3; i++ {
+		checkResponseCode(t, http.StatusBadRequest, login(t).StatusCode)
+	}
+	rr := login(t)
+	checkResponseCode(t, http.StatusTooManyRequests, rr.StatusCode)
+	if retryAfter := rr.Header.Get("Retry-After"); retryAfter != "60" {
+		t.Errorf("expected to retry after 60 seconds, got %q", retryAfter)
+	}
+	if sent := app.mailer.(*mailer.MockMailer).Sent; len(sent) != 1 {
+		t.Errorf("expected one account locked email, got %d", len(sent))
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"expvar"
 	"log"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/auth"
@@ -13,6 +16,7 @@ import (
 	"github.com/Shadowcyng/goSocial/internal/ratelimiter"
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/Shadowcyng/goSocial/internal/store/cache"
+	"github.com/Shadowcyng/goSocial/internal/timeline"
 	"github.com/go-redis/redis/v8"
 	"go.uber.org/zap"
 )
@@ -53,9 +57,13 @@ func main() {
 			maxIdleTimes: env.GetString("DB_MAX_IDLE_TIMES", "15m"),
 		},
 		mail: mailConfig{
-			exp:       time.Hour * 24 * 3, // 3days
-			apiKey:    env.GetString("MAIL_SERVICE_API_KEY", ""),
-			fromEmail: env.GetString("FROM_EMAIL", ""),
+			exp:           time.Hour * 24 * 3, // 3days
+			resetExp:      time.Hour,          // 1 hour
+			sweepInterval: time.Hour,          // 1 hour
+			resendLimit:   env.GetInt("MAIL_RESEND_LIMIT", 3),
+			resendWindow:  time.Hour,
+			apiKey:        env.GetString("MAIL_SERVICE_API_KEY", ""),
+			fromEmail:     env.GetString("FROM_EMAIL", ""),
 		},
 		auth: authConfig{
 			basic: basicConfig{
@@ -63,11 +71,49 @@ func main() {
 				pass: env.GetString("AUTH_BASIC_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("JWT_SECRET", ""),
-				exp:    (time.Hour * 24 * 3), // 3 days
-				issuer: "GoSocial",
+				secret:     env.GetString("JWT_SECRET", ""),
+				keysDir:    env.GetString("JWT_KEYS_DIR", ""),
+				activeKid:  env.GetString("JWT_ACTIVE_KID", ""),
+				exp:        time.Minute * 15,   // 15 minutes
+				refreshExp: time.Hour * 24 * 7, // 7 days
+				issuer:     "GoSocial",
+			},
+			mfa: mfaConfig{
+				requiredLevel: env.GetInt("MFA_REQUIRED_ROLE_LEVEL", 0),
+				challengeExp:  time.Minute * 5, // 5 minutes
+			},
+			lockout: lockoutConfig{
+				maxAttempts:   env.GetInt("LOGIN_MAX_ATTEMPTS", 5),
+				maxIPAttempts: env.GetInt("LOGIN_MAX_IP_ATTEMPTS", 50),
+				window:        time.Minute * 15,
+				baseDuration:  time.Minute,
+				maxDuration:   time.Hour * 24,
+			},
+			impersonation: impersonationConfig{
+				exp:         time.Minute * 10, // 10 minutes
+				allowWrites: env.GetBool("IMPERSONATION_ALLOW_WRITES", false),
+			},
+			session: sessionConfig{
+				cookieDomain:  env.GetString("SESSION_COOKIE_DOMAIN", ""),
+				secureCookies: env.GetBool("SESSION_COOKIE_SECURE", true),
+			},
+			oidc: oidcConfig{
+				provider: env.GetString("OIDC_PROVIDER", "oidc"),
+				client: auth.OIDCConfig{
+					Issuer:       env.GetString("OIDC_ISSUER", ""),
+					ClientID:     env.GetString("OIDC_CLIENT_ID", ""),
+					ClientSecret: env.GetString("OIDC_CLIENT_SECRET", ""),
+					AuthURL:      env.GetString("OIDC_AUTH_URL", ""),
+					TokenURL:     env.GetString("OIDC_TOKEN_URL", ""),
+					JWKSURL:      env.GetString("OIDC_JWKS_URL", ""),
+					RedirectURL:  env.GetString("OIDC_REDIRECT_URL", "localhost:4000/oidc/callback"),
+				},
+				stateExp: time.Minute * 10, // 10 minutes
 			},
 		},
+		cors: corsConfig{
+			allowedOrigins: strings.Split(env.GetString("CORS_ALLOWED_ORIGINS", "http://localhost:4000"), ","),
+		},
 		redis: redisConfig{
 			addr:    env.GetString("REDIS_ADDR", "localhost:6379"),
 			pw:      env.GetString("REDIS_PW", "satyam123"),
@@ -79,6 +125,24 @@ func main() {
 			TimeFrame:           time.Second * 5,
 			Enabled:             env.GetBool("RATE_LIMITER_ENABLE", true),
 		},
+		feed: feedConfig{
+			cursorSecret: env.GetString("FEED_CURSOR_SECRET", ""),
+			timeline: timelineConfig{
+				enabled: env.GetBool("FEED_TIMELINE_ENABLED", false),
+				config: timeline.Config{
+					Size:               env.GetInt("FEED_TIMELINE_SIZE", 800),
+					CelebrityFollowers: env.GetInt("FEED_CELEBRITY_FOLLOWERS", 10000),
+					TTL:                time.Hour * 24 * 7, // 7 days
+				},
+			},
+		},
+		comments: commentConfig{
+			maxDepth:      env.GetInt("COMMENT_MAX_DEPTH", 5),
+			threadReplies: env.GetInt("COMMENT_THREAD_REPLIES", 20),
+		},
+		reactions: reactionConfig{
+			types: strings.Split(env.GetString("REACTION_TYPES", "like,love,haha,wow,sad,angry"), ","),
+		},
 	}
 	// Logger
 	logger := zap.Must(zap.NewProduction()).Sugar()
@@ -104,11 +168,26 @@ func main() {
 		logger.Info("redis connection  established")
 	}
 
+	// cursors signed with a random secret stop working on restart and on other instances
+	if cfg.feed.cursorSecret == "" {
+		logger.Warn("FEED_CURSOR_SECRET is not set, using a random secret for feed cursors")
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			logger.Fatal(err)
+		}
+		cfg.feed.cursorSecret = hex.EncodeToString(secret)
+	}
+
 	// Store
 	store := store.NewStorage(db)
 
 	// cache
 	cacheSotrage := cache.NewRedisStorage(rdb)
+	if !cfg.redis.enabled {
+		cacheSotrage.Tokens = cache.NewMemoryTokenStore()
+		cacheSotrage.LoginAttempts = cache.NewMemoryLoginAttemptStore()
+		cacheSotrage.OAuthStates = cache.NewMemoryOAuthStateStore()
+	}
 	mailer, err := mailer.NewMailerService(cfg.mail.apiKey, cfg.mail.fromEmail)
 	if err != nil {
 		log.Fatal(err)
@@ -116,8 +195,19 @@ func main() {
 
 	// rate limiter
 	rateLimiter := ratelimiter.NewFixedWindowLimiter(cfg.rateLimiter.RequestPerTimeFrame, cfg.rateLimiter.TimeFrame)
-
-	jwtAuthenticator := auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.issuer, cfg.auth.token.issuer)
+	// activation emails are limited per address so the endpoint can't flood an inbox
+	resendLimiter := ratelimiter.NewFixedWindowLimiter(cfg.mail.resendLimit, cfg.mail.resendWindow)
+
+	// authenticator, asymmetric keys are used when a key directory is configured
+	var jwtAuthenticator auth.Authenticator
+	if cfg.auth.token.keysDir != "" {
+		jwtAuthenticator, err = auth.NewKeySetAuthenticator(cfg.auth.token.keysDir, cfg.auth.token.activeKid, cfg.auth.token.issuer, cfg.auth.token.issuer)
+		if err != nil {
+			logger.Fatal(err)
+		}
+	} else {
+		jwtAuthenticator = auth.NewJWTAuthenticator(cfg.auth.token.secret, cfg.auth.token.issuer, cfg.auth.token.issuer)
+	}
 	app := &application{
 		config:        cfg,
 		store:         store,
@@ -126,6 +216,19 @@ func main() {
 		authenticator: jwtAuthenticator,
 		cacheStorage:  cacheSotrage,
 		rateLimiter:   rateLimiter,
+		resendLimiter: resendLimiter,
+		permissions:   newPermissionCache(time.Minute),
+		audit:         NewAuditLogger(store, logger),
+	}
+	if cfg.auth.oidc.client.ClientID != "" {
+		app.oidcProvider = auth.NewOIDCProvider(cfg.auth.oidc.client)
+	}
+	if cfg.feed.timeline.enabled {
+		if cfg.redis.enabled {
+			app.timeline = timeline.New(store, cacheSotrage, cfg.feed.timeline.config)
+		} else {
+			logger.Warn("FEED_TIMELINE_ENABLED needs REDIS_ENABLED, the feed is read from the database")
+		}
 	}
 
 	// Metrics collected
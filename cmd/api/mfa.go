@@ -0,0 +1,490 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/auth"
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const recoveryCodeCount = 10
+
+var (
+	errInvalidMFACode  = errors.New("invalid two-factor code")
+	errInvalidMFAToken = errors.New("invalid mfa token")
+)
+
+type MFAChallengeResponse struct {
+	MFARequired        bool   `json:"mfa_required"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+	MFAToken           string `json:"mfa_token"`
+	ExpiresAt          int64  `json:"expires_at"`
+}
+
+type TOTPEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type MFATokenResponse struct {
+	*TokenResponse
+	RecoveryCodes []string `json:"recovery_codes,omitempty"`
+}
+
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type MFAChallengePayload struct {
+	MFAToken string `json:"mfa_token" validate:"required"`
+}
+
+type VerifyMFAChallengePayload struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"omitempty,max=20"`
+}
+
+type TOTPCodePayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type DisableTOTPPayload struct {
+	CurrentPassword string `json:"current_password" validate:"required,max=72"`
+	Code            string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode    string `json:"recovery_code" validate:"omitempty,max=20"`
+}
+
+// @Summary		Completes a two factor login
+// @Description	Exchanges the mfa challenge token and a TOTP or recovery code for the access and refresh tokens.
+// @Description	When the challenge was issued for a required enrollment the code confirms the enrollment and the recovery codes are returned
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		VerifyMFAChallengePayload	true	"Challenge token and code"
+// @Success		201		{object}	MFATokenResponse
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Invalid challenge or code"
+// @Failure		429		{object}	error	"Too many failed attempts"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/token/mfa	[post]
+func (app *application) verifyMFAChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFAChallengePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, claims, err := app.parseMFAChallenge(ctx, payload.MFAToken)
+	if err != nil {
+		switch err {
+		case errInvalidMFAToken, store.ErrorNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	ip := clientIP(r)
+	lockedFor, err := app.loginLockedFor(ctx, ip, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if lockedFor > 0 {
+		app.accountLockedResponse(w, r, lockedFor)
+		return
+	}
+
+	var recoveryCodes []string
+	if !user.TOTPEnabled {
+		// the challenge was issued because the role requires two factor authentication
+		if user.TOTPSecret == "" {
+			app.badRequestResponse(w, r, fmt.Errorf("two-factor enrollment has not been started"))
+			return
+		}
+		recoveryCodes, err = app.enableTOTP(ctx, user, payload.Code)
+	} else {
+		err = app.verifySecondFactor(ctx, user, payload.Code, payload.RecoveryCode)
+	}
+	if err != nil {
+		switch err {
+		case errInvalidMFACode:
+			app.registerLoginFailure(ctx, ip, user)
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// a challenge can only be completed once
+	if err := app.revokeAccessToken(ctx, claims); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+	app.resetLoginFailures(ctx, user)
+	tokens, err := app.issueTokens(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	tokens, err = app.sessionResponse(w, r, tokens)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusCreated, MFATokenResponse{TokenResponse: tokens, RecoveryCodes: recoveryCodes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Starts a required two factor enrollment
+// @Description	Generates the TOTP secret for a user whose role requires two factor authentication, using the mfa challenge token
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		MFAChallengePayload	true	"Challenge token"
+// @Success		201		{object}	TOTPEnrollment
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Invalid challenge"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/token/mfa/enroll	[post]
+func (app *application) enrollMFAChallengeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFAChallengePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, _, err := app.parseMFAChallenge(ctx, payload.MFAToken)
+	if err != nil {
+		switch err {
+		case errInvalidMFAToken, store.ErrorNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if user.TOTPEnabled {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	enrollment, err := app.startTOTPEnrollment(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Starts two factor enrollment
+// @Description	Generates a TOTP secret and provisioning URI for the authenticated user, it's enforced once a code is verified
+// @Tags			users
+// @Produce		json
+// @Success		201	{object}	TOTPEnrollment
+// @Failure		400	{object}	error	"Two factor authentication is already enabled"
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/mfa/totp	[post]
+func (app *application) startTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, getAuthUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if user.TOTPEnabled {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+
+	enrollment, err := app.startTOTPEnrollment(ctx, user)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusCreated, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Enables two factor authentication
+// @Description	Verifies the first TOTP code of the enrollment and returns single use recovery codes
+// @Tags			users
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		TOTPCodePayload	true	"TOTP code"
+// @Success		200		{object}	RecoveryCodesResponse
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Invalid code"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/mfa/totp/verify	[post]
+func (app *application) enableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload TOTPCodePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, getAuthUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if user.TOTPEnabled {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor authentication is already enabled"))
+		return
+	}
+	if user.TOTPSecret == "" {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor enrollment has not been started"))
+		return
+	}
+
+	recoveryCodes, err := app.enableTOTP(ctx, user, payload.Code)
+	if err != nil {
+		switch err {
+		case errInvalidMFACode:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit.Log(r, auditUserMFAEnable, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	if err := jsonResponse(w, http.StatusOK, RecoveryCodesResponse{RecoveryCodes: recoveryCodes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Disables two factor authentication
+// @Description	Turns two factor authentication off, not allowed when the role of the user requires it
+// @Tags			users
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		DisableTOTPPayload	true	"Password and TOTP or recovery code"
+// @Success		204		{string}	string	"Two factor authentication disabled"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Invalid code"
+// @Failure		403		{object}	error	"Required by role"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/mfa/totp	[delete]
+func (app *application) disableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DisableTOTPPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.GetById(ctx, getAuthUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if app.mfaRequired(user) {
+		app.forbiddenError(w, r, fmt.Errorf("two-factor authentication is required for role %s", user.Role.Name))
+		return
+	}
+	if !user.TOTPEnabled {
+		app.badRequestResponse(w, r, fmt.Errorf("two-factor authentication is not enabled"))
+		return
+	}
+	if err := user.Password.Validate(payload.CurrentPassword); err != nil {
+		app.invalidCredentials(w, r, err)
+		return
+	}
+	if err := app.verifySecondFactor(ctx, user, payload.Code, payload.RecoveryCode); err != nil {
+		switch err {
+		case errInvalidMFACode:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.store.MFA.DisableTOTP(ctx, user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+	app.audit.Log(r, auditUserMFADisable, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mfaRequired reports whether the role of the user requires two factor authentication
+func (app *application) mfaRequired(user *store.User) bool {
+	level := app.config.auth.mfa.requiredLevel
+	return level > 0 && user.Role.Level >= level
+}
+
+func (app *application) generateMFAChallenge(user *store.User) (*MFAChallengeResponse, error) {
+	now := time.Now()
+	exp := now.Add(app.config.auth.mfa.challengeExp).Unix()
+	claims := jwt.MapClaims{
+		"sub": user.ID,
+		"exp": exp,
+		"iat": now.Unix(),
+		"nbf": now.Unix(),
+		"iss": app.config.auth.token.issuer,
+		"aud": app.config.auth.token.issuer,
+		"jti": uuid.New().String(),
+		"typ": "mfa",
+	}
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+	return &MFAChallengeResponse{
+		MFARequired:        true,
+		EnrollmentRequired: !user.TOTPEnabled,
+		MFAToken:           token,
+		ExpiresAt:          exp,
+	}, nil
+}
+
+// parseMFAChallenge validates a challenge token and returns its user and claims
+func (app *application) parseMFAChallenge(ctx context.Context, token string) (*store.User, jwt.MapClaims, error) {
+	jwtToken, err := app.authenticator.ValidateToken(token)
+	if err != nil {
+		return nil, nil, errInvalidMFAToken
+	}
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	if typ, _ := claims["typ"].(string); typ != "mfa" {
+		return nil, nil, errInvalidMFAToken
+	}
+	jti, _ := claims["jti"].(string)
+	revoked, err := app.cacheStorage.Tokens.IsRevoked(ctx, jti)
+	if err != nil {
+		return nil, nil, err
+	}
+	if revoked {
+		return nil, nil, errInvalidMFAToken
+	}
+	userID, err := userIDFromClaims(claims)
+	if err != nil {
+		return nil, nil, errInvalidMFAToken
+	}
+
+	// cached users don't carry the totp secret, always read the user from db
+	user, err := app.store.Users.GetById(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, claims, nil
+}
+
+func (app *application) startTOTPEnrollment(ctx context.Context, user *store.User) (*TOTPEnrollment, error) {
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := app.store.MFA.SetTOTPSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{
+		Secret:          secret,
+		ProvisioningURI: auth.TOTPProvisioningURI(secret, app.config.auth.token.issuer, user.Username),
+	}, nil
+}
+
+// enableTOTP confirms the enrollment with the first code and returns the plain recovery codes
+func (app *application) enableTOTP(ctx context.Context, user *store.User, code string) ([]string, error) {
+	if err := app.verifyTOTP(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 5)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		plain := hex.EncodeToString(b)
+		codes[i] = plain[:5] + "-" + plain[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err := app.store.MFA.EnableTOTP(ctx, user.ID, hashes); err != nil {
+		return nil, err
+	}
+	app.deleteUserCache(ctx, user.ID)
+	return codes, nil
+}
+
+// verifySecondFactor checks a TOTP code, or consumes a recovery code when no code is given
+func (app *application) verifySecondFactor(ctx context.Context, user *store.User, code, recoveryCode string) error {
+	if code != "" {
+		return app.verifyTOTP(ctx, user, code)
+	}
+	ok, err := app.store.MFA.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(recoveryCode))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+func (app *application) verifyTOTP(ctx context.Context, user *store.User, code string) error {
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return errInvalidMFACode
+	}
+	// every code can only be used once
+	ok, err := app.store.MFA.UseTOTPStep(ctx, user.ID, step)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidMFACode
+	}
+	return nil
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	return hashToken(code)
+}
@@ -4,9 +4,11 @@ import (
 	"context"
 	"encoding/base64"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/golang-jwt/jwt/v5"
@@ -50,18 +52,35 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// read the auth header
 		authHeader := r.Header.Get("Authorization")
+		var token string
 		if authHeader == "" {
-			app.unauthorizedError(w, r, fmt.Errorf("authorization header is missing"))
-			return
+			// browser clients in the cookie session mode
+			cookie, err := r.Cookie(accessTokenCookie)
+			if err != nil || cookie.Value == "" {
+				app.unauthorizedError(w, r, fmt.Errorf("authorization header is missing"))
+				return
+			}
+			// cookies are sent by the browser on its own, so state changes need the csrf token
+			if err := checkCSRF(r); err != nil {
+				app.forbiddenError(w, r, err)
+				return
+			}
+			token = cookie.Value
+		} else {
+			// parse it -> get the token
+			parts := strings.Split(authHeader, " ") // authorization: Bearer <token>
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				app.unauthorizedError(w, r, fmt.Errorf("authorization header is malformed"))
+				return
+			}
+			token = parts[1]
 		}
-		// parse it -> get the token
-		parts := strings.Split(authHeader, " ") // authorization: Bearer <token>
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			app.unauthorizedError(w, r, fmt.Errorf("authorization header is malformed"))
+		// personal access tokens are opaque and looked up in the db
+		if strings.HasPrefix(token, personalAccessTokenPrefix) {
+			app.personalAccessTokenAuth(w, r, next, token)
 			return
 		}
 		// validate token
-		token := parts[1]
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
 			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
@@ -70,14 +89,44 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		// parse the claims
 		claims, _ := jwtToken.Claims.(jwt.MapClaims)
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
-
+		userID, err := userIDFromClaims(claims)
 		if err != nil {
 			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
 			return
 		}
+		// only access tokens authenticate requests, not mfa challenges
+		if typ, _ := claims["typ"].(string); typ != "" {
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token type %s", typ))
+			return
+		}
 
 		ctx := r.Context()
+		// check the token has not been revoked (logout)
+		if jti, ok := claims["jti"].(string); ok {
+			revoked, err := app.cacheStorage.Tokens.IsRevoked(ctx, jti)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if revoked {
+				app.unauthorizedError(w, r, fmt.Errorf("token has been revoked"))
+				return
+			}
+		}
+		// check all sessions of the user has not been revoked (password reset)
+		revokedAt, err := app.cacheStorage.Tokens.UserRevokedAt(ctx, userID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !revokedAt.IsZero() {
+			iat, ok := issuedAtFromClaims(claims)
+			if !ok || iat.Before(revokedAt) {
+				app.unauthorizedError(w, r, fmt.Errorf("token has been revoked"))
+				return
+			}
+		}
+
 		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			switch err {
@@ -89,12 +138,97 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 				return
 			}
 		}
+		if user.IsSuspended() {
+			app.accountSuspendedResponse(w, r, user)
+			return
+		}
+		// impersonation tokens carry the admin acting as the user
+		if act, ok := claims["act"]; ok {
+			if ctx, ok = app.impersonate(w, r, ctx, user, act); !ok {
+				return
+			}
+		}
 		ctx = context.WithValue(ctx, authCtx, user)
+		ctx = context.WithValue(ctx, claimsCtx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+func (app *application) personalAccessTokenAuth(w http.ResponseWriter, r *http.Request, next http.Handler, token string) {
+	ctx := r.Context()
+	pat, err := app.store.PersonalAccessTokens.GetByToken(ctx, hashToken(token))
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	user, err := app.getUser(ctx, pat.UserID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, fmt.Errorf("invalid token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if user.IsSuspended() {
+		app.accountSuspendedResponse(w, r, user)
+		return
+	}
+	if err := app.store.PersonalAccessTokens.Touch(ctx, pat.ID); err != nil {
+		app.logger.Errorw("error updating token last used", "token", pat.ID, "error", err)
+	}
+	ctx = context.WithValue(ctx, authCtx, user)
+	ctx = context.WithValue(ctx, patCtx, pat)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireScope restricts personal access tokens to the routes their scopes allow,
+// session tokens are not scoped
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			pat := getPersonalAccessTokenFromContext(r)
+			if pat != nil && !pat.HasScope(scope) {
+				app.forbiddenError(w, r, fmt.Errorf("token is missing scope %s", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireSession keeps account management out of reach of personal access tokens
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if getPersonalAccessTokenFromContext(r) != nil {
+			app.forbiddenError(w, r, fmt.Errorf("personal access tokens can not manage the account"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func userIDFromClaims(claims jwt.MapClaims) (int64, error) {
+	return strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+}
+
+// issuedAtFromClaims reads the iat claim to the millisecond, GetIssuedAt truncates it to seconds
+func issuedAtFromClaims(claims jwt.MapClaims) (time.Time, bool) {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.UnixMilli(int64(math.Round(iat * 1e3))), true
+}
+
+// checkPostOwnership lets the owner of the post through, other users need permission
+func (app *application) checkPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := getAuthUserFromContext(r)
 		post := getPostFromContext(r)
@@ -104,8 +238,7 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 			next.ServeHTTP(w, r)
 			return
 		}
-		// role precendece check
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+		allowed, err := app.hasPermission(r.Context(), user, permission)
 		if err != nil {
 			app.internalServerError(w, r, err)
 			return
@@ -118,12 +251,27 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	})
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *store.User, roleName string) (bool, error) {
-	role, err := app.store.Role.GetByName(ctx, roleName)
-	if err != nil {
-		return false, err
-	}
-	return user.Role.Level >= role.Level, nil
+// checkCommentOwnership lets the author of the comment through, other users need permission
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := getAuthUserFromContext(r)
+		comment := getCommentFromContext(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowed, err := app.hasPermission(r.Context(), user, permission)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		if !allowed {
+			app.forbiddenError(w, r, fmt.Errorf("user is not allowed to perform this action"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
 }
 
 func (app *application) getUser(ctx context.Context, userID int64) (*store.User, error) {
@@ -150,6 +298,14 @@ func (app *application) getUser(ctx context.Context, userID int64) (*store.User,
 	return user, nil
 }
 
+// deleteUserCache drops the cached user so the next read goes to the db
+func (app *application) deleteUserCache(ctx context.Context, userID int64) {
+	if !app.config.redis.enabled {
+		return
+	}
+	app.cacheStorage.Users.Delete(ctx, userID)
+}
+
 func (app *application) rateLimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.config.rateLimiter.Enabled {
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Shadowcyng/goSocial/internal/auth"
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+var (
+	errInvalidOAuthState = errors.New("invalid or expired state")
+	errEmailNotVerified  = errors.New("the provider has not verified the email of this account")
+)
+
+// usernameInvalidChars are removed from the email local part to build the username of new users
+var usernameInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+type OIDCAuthorizeResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+	State            string `json:"state"`
+}
+
+type OIDCCallbackPayload struct {
+	Code  string `json:"code" validate:"required,max=2048"`
+	State string `json:"state" validate:"required,max=100"`
+}
+
+// oidcFlow is what is kept server side between the authorization request and the callback
+type oidcFlow struct {
+	CodeVerifier string `json:"code_verifier"`
+	Nonce        string `json:"nonce"`
+}
+
+// @Summary		Starts an external login
+// @Description	Returns the url of the OpenID Connect provider the user has to be redirected to
+// @Tags			authentication
+// @Produce		json
+// @Success		200	{object}	OIDCAuthorizeResponse
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @Router			/authentication/oidc/authorize	[get]
+func (app *application) oidcAuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	verifier, err := auth.NewPKCEVerifier()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	state, err := randomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := randomString()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	flow, err := json.Marshal(oidcFlow{CodeVerifier: verifier, Nonce: nonce})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := app.cacheStorage.OAuthStates.Save(r.Context(), state, string(flow), app.config.auth.oidc.stateExp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	res := OIDCAuthorizeResponse{
+		AuthorizationURL: app.oidcProvider.AuthCodeURL(state, nonce, auth.PKCEChallenge(verifier)),
+		State:            state,
+	}
+	if err := jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Completes an external login
+// @Description	Exchanges the authorization code of the provider and signs the user in.
+// @Description	The identity is linked to the account with the same verified email, or a new account is created
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		OIDCCallbackPayload	true	"Authorization code and state"
+// @Success		201		{object}	TokenResponse
+// @Success		200		{object}	MFAChallengeResponse	"Two factor authentication is required"
+// @Failure		400		{object}	error					"Bad request"
+// @Failure		401		{object}	error					"Invalid state or code"
+// @Failure		403		{object}	error					"Email not verified"
+// @Failure		409		{object}	error					"Email belongs to an account pending activation or the identity is already linked"
+// @Failure		500		{object}	error					"Somehting went wrong"
+// @Router			/authentication/oidc/callback	[post]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	var payload OIDCCallbackPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	raw, err := app.cacheStorage.OAuthStates.Pop(ctx, payload.State)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if raw == "" {
+		app.unauthorizedError(w, r, errInvalidOAuthState)
+		return
+	}
+	var flow oidcFlow
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	identity, err := app.oidcProvider.Exchange(ctx, payload.Code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		app.unauthorizedError(w, r, err)
+		return
+	}
+
+	user, err := app.userForIdentity(ctx, identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailNotVerified):
+			app.forbiddenError(w, r, err)
+		case errors.Is(err, store.ErrorDuplicateEmail), errors.Is(err, store.ErrorConflict):
+			// a concurrent callback linked the identity first
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrorNotFound):
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.loginResponse(w, r, user)
+}
+
+// userForIdentity returns the user linked to the identity. An unknown identity is linked to
+// the active user with the same email, or registers a new user; both need a verified email
+func (app *application) userForIdentity(ctx context.Context, identity *auth.OIDCIdentity) (*store.User, error) {
+	provider := app.config.auth.oidc.provider
+	linked, err := app.store.Identities.GetBySubject(ctx, provider, identity.Subject)
+	switch {
+	case err == nil:
+		return app.store.Users.GetById(ctx, linked.UserID)
+	case !errors.Is(err, store.ErrorNotFound):
+		return nil, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return nil, errEmailNotVerified
+	}
+	userIdentity := &store.UserIdentity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	user, err := app.store.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		userIdentity.UserID = user.ID
+		if err := app.store.Identities.Create(ctx, userIdentity); err != nil {
+			return nil, err
+		}
+		app.logger.Infow("linked external identity", "user", user.ID, "provider", provider)
+		return user, nil
+	case !errors.Is(err, store.ErrorNotFound):
+		return nil, err
+	}
+
+	return app.createUserForIdentity(ctx, identity, userIdentity)
+}
+
+func (app *application) createUserForIdentity(ctx context.Context, identity *auth.OIDCIdentity, userIdentity *store.UserIdentity) (*store.User, error) {
+	// the account can only be used through the provider until the user resets the password
+	password, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	base := usernameInvalidChars.ReplaceAllString(strings.Split(identity.Email, "@")[0], "")
+	if len(base) < 3 {
+		base = "user"
+	}
+
+	// retry with a random suffix when the username is already taken
+	for attempt := 0; attempt < 3; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := randomString()
+			if err != nil {
+				return nil, err
+			}
+			username = fmt.Sprintf("%s_%s", base, suffix[:6])
+		}
+		user := &store.User{
+			Username: username,
+			Email:    identity.Email,
+		}
+		if err := user.Password.Set(password); err != nil {
+			return nil, err
+		}
+
+		err := app.store.Identities.CreateUser(ctx, user, userIdentity)
+		if errors.Is(err, store.ErrorDuplicateUsername) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		app.logger.Infow("registered user from external identity", "user", user.ID, "provider", userIdentity.Provider)
+		// load the role of the new user
+		return app.store.Users.GetById(ctx, user.ID)
+	}
+	return nil, store.ErrorDuplicateUsername
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/google/uuid"
+)
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=100"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// @Summary		Forgot password
+// @Description	Sends a password reset link to the email if an account exists for it
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		ForgotPasswordPayload	true	"User email"
+// @Success		202		{string}	string	"Reset link sent if the account exists"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/password/forgot	[post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the response is the same whether the account exists or not
+	// so the endpoint can't be used to find out registered emails
+	accepted := "if an account exists for this email, a reset link has been sent"
+	ctx := r.Context()
+	user, err := app.store.Users.GetByEmail(ctx, payload.Email)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			if err := jsonResponse(w, http.StatusAccepted, accepted); err != nil {
+				app.internalServerError(w, r, err)
+			}
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+	if err := app.store.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.mail.resetExp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	// send email
+	resetURL := fmt.Sprintf("%s/reset-password/%s", app.config.frontendURL, plainToken)
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  resetURL,
+		ExpiresIn: app.config.mail.resetExp.String(),
+	}
+	err = app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, !isProdEnv)
+	if err != nil {
+		app.logger.Errorw("error sending password reset email", "error", err)
+	}
+	if err := jsonResponse(w, http.StatusAccepted, accepted); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Reset password
+// @Description	Sets a new password using the emailed reset token and logs out all the sessions of the user
+// @Tags			authentication
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		ResetPasswordPayload	true	"Reset token and new password"
+// @Success		204		{string}	string	"Password reset"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/authentication/password/reset	[post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var password store.Password
+	if err := password.Set(payload.Password); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user, err := app.store.Users.ResetPassword(ctx, payload.Token, &password)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.badRequestResponse(w, r, fmt.Errorf("invalid or expired reset token"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// refresh tokens are gone with the reset, revoke the access tokens still in flight
+	if err := app.cacheStorage.Tokens.RevokeUser(ctx, user.ID, app.config.auth.token.exp); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+	app.audit.Log(r, auditUserPasswordReset, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+func TestPasswordReset(t *testing.T) {
+	app := NewTestApplication(t)
+	app.config.auth.token.exp = time.Hour
+	mux := app.mount()
+
+	post := func(t *testing.T, url, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		return executeRequest(req, mux)
+	}
+	getUser := func(t *testing.T, token string) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should answer the same for unknown emails", func(t *testing.T) {
+		known := post(t, "/v1/authentication/password/forgot", `{"email": "known@example.com"}`)
+		unknown := post(t, "/v1/authentication/password/forgot", `{"email": "unknown@example.com"}`)
+		checkResponseCode(t, http.StatusAccepted, known.Code)
+		checkResponseCode(t, http.StatusAccepted, unknown.Code)
+		if known.Body.String() != unknown.Body.String() {
+			t.Errorf("expected the same response, got %q and %q", known.Body.String(), unknown.Body.String())
+		}
+	})
+	t.Run("should reject an invalid reset token", func(t *testing.T) {
+		rr := post(t, "/v1/authentication/password/reset", `{"token": "expired", "password": "new-password"}`)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("should revoke the tokens issued before the reset only", func(t *testing.T) {
+		user := &store.User{ID: 1}
+		before, _, err := app.generateAccessToken(user)
+		if err != nil {
+			t.Fatalf("could not generate token: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+
+		rr := post(t, "/v1/authentication/password/reset", `{"token": "valid", "password": "new-password"}`)
+		checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+		// issued right after the reset, usually within the same second
+		after, _, err := app.generateAccessToken(user)
+		if err != nil {
+			t.Fatalf("could not generate token: %v", err)
+		}
+		checkResponseCode(t, http.StatusUnauthorized, getUser(t, before))
+		checkResponseCode(t, http.StatusOK, getUser(t, after))
+	})
+}
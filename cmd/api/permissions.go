@@ -0,0 +1,408 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// permissions checked by the api, roles get them through the role_permissions table
+const (
+	permPostsUpdateAny    = "posts.update.any"
+	permPostsDeleteAny    = "posts.delete.any"
+	permCommentsUpdateAny = "comments.update.any"
+	permCommentsDeleteAny = "comments.delete.any"
+	permUsersManage       = "users.manage"
+	permUsersImpersonate  = "users.impersonate"
+	permRolesManage       = "roles.manage"
+)
+
+// permissionCache keeps the permission set of every role in memory. It is reloaded after ttl
+// so changes made by other instances are picked up, and right away on changes made by this one
+type permissionCache struct {
+	mu       sync.RWMutex
+	roles    map[int64]map[string]bool
+	loadedAt time.Time
+	ttl      time.Duration
+}
+
+func newPermissionCache(ttl time.Duration) *permissionCache {
+	return &permissionCache{ttl: ttl}
+}
+
+func (c *permissionCache) get(roleID int64) (map[string]bool, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.roles == nil || time.Since(c.loadedAt) > c.ttl {
+		return nil, false
+	}
+	return c.roles[roleID], true
+}
+
+func (c *permissionCache) set(roles []store.Role) {
+	sets := make(map[int64]map[string]bool, len(roles))
+	for _, role := range roles {
+		sets[role.ID] = permissionSet(role.Permissions)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roles = sets
+	c.loadedAt = time.Now()
+}
+
+func (c *permissionCache) invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.roles = nil
+}
+
+func permissionSet(permissions []string) map[string]bool {
+	set := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		set[p] = true
+	}
+	return set
+}
+
+// rolePermissions returns the permission set of the role, empty for unknown roles
+func (app *application) rolePermissions(ctx context.Context, roleID int64) (map[string]bool, error) {
+	set, ok := app.permissions.get(roleID)
+	if !ok {
+		roles, err := app.store.Role.GetAll(ctx)
+		if err != nil {
+			return nil, err
+		}
+		app.permissions.set(roles)
+		set, _ = app.permissions.get(roleID)
+	}
+	return set, nil
+}
+
+// hasPermission reports whether the role of the user grants permission
+func (app *application) hasPermission(ctx context.Context, user *store.User, permission string) (bool, error) {
+	set, err := app.rolePermissions(ctx, user.Role.ID)
+	if err != nil {
+		return false, err
+	}
+	return set[permission], nil
+}
+
+// canGrant reports whether the role of the user grants every one of the permissions, users can
+// only hand out what they hold themselves
+func (app *application) canGrant(ctx context.Context, user *store.User, permissions map[string]bool) (bool, error) {
+	own, err := app.rolePermissions(ctx, user.Role.ID)
+	if err != nil {
+		return false, err
+	}
+	for p := range permissions {
+		if !own[p] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// outranks reports whether the role of the user grants every permission of the other role and
+// more. Roles rank by what they allow, the level of custom roles says nothing about that
+func (app *application) outranks(ctx context.Context, user *store.User, roleID int64) (bool, error) {
+	if user.Role.ID == roleID {
+		return false, nil
+	}
+	own, err := app.rolePermissions(ctx, user.Role.ID)
+	if err != nil {
+		return false, err
+	}
+	other, err := app.rolePermissions(ctx, roleID)
+	if err != nil {
+		return false, err
+	}
+	for p := range other {
+		if !own[p] {
+			return false, nil
+		}
+	}
+	return len(own) > len(other), nil
+}
+
+// RequirePermission allows the request only when the role of the authenticated user grants permission
+func (app *application) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			allowed, err := app.hasPermission(r.Context(), getAuthUserFromContext(r), permission)
+			if err != nil {
+				app.internalServerError(w, r, err)
+				return
+			}
+			if !allowed {
+				app.forbiddenError(w, r, fmt.Errorf("missing permission %s", permission))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type CreateRolePayload struct {
+	Name        string   `json:"name" validate:"required,max=100"`
+	Description string   `json:"description" validate:"max=255"`
+	Permissions []string `json:"permissions" validate:"unique,dive,max=100"`
+}
+
+type RolePermissionsPayload struct {
+	Permissions []string `json:"permissions" validate:"unique,dive,max=100"`
+}
+
+type AssignRolePayload struct {
+	Role string `json:"role" validate:"required,max=100"`
+}
+
+// @Summary		Lists roles
+// @Description	Lists the roles with their permissions
+// @Tags			admin
+// @Produce		json
+// @Success		200	{object}	[]store.Role
+// @Failure		403	{object}	error	"Forbidden"
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/roles	[get]
+func (app *application) getRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.store.Role.GetAll(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Lists permissions
+// @Description	Lists the permissions which can be granted to roles
+// @Tags			admin
+// @Produce		json
+// @Success		200	{object}	[]store.Permission
+// @Failure		403	{object}	error	"Forbidden"
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/permissions	[get]
+func (app *application) getPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.store.Role.GetPermissions(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, permissions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Creates a role
+// @Description	Creates a custom role with a set of permissions, only permissions the user holds can be granted
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		CreateRolePayload	true	"Role name and permissions"
+// @Success		201		{object}	store.Role
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		403		{object}	error	"Permission not held by the user"
+// @Failure		409		{object}	error	"Role already exists"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/roles	[post]
+func (app *application) createRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreateRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	allowed, err := app.canGrant(r.Context(), getAuthUserFromContext(r), permissionSet(payload.Permissions))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenError(w, r, fmt.Errorf("permissions not held by the user can not be granted"))
+		return
+	}
+
+	role := &store.Role{
+		Name:        payload.Name,
+		Description: payload.Description,
+		Permissions: payload.Permissions,
+	}
+	if err := app.store.Role.Create(r.Context(), role); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictError(w, r, err)
+		case errors.Is(err, store.ErrorNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("unknown permission"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.permissions.invalidate()
+	app.audit.Log(r, auditRoleCreate, AuditTarget{Type: "role", ID: role.ID}, nil, role)
+	if err := jsonResponse(w, http.StatusCreated, role); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Sets the permissions of a role
+// @Description	Replaces the permissions of a role. The role must rank below the own role and only
+// @Description	permissions the user holds can be granted
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			roleID	path		int						true	"Role ID"
+// @Param			payload	body		RolePermissionsPayload	true	"Permissions"
+// @Success		204		{string}	string					"Permissions updated"
+// @Failure		400		{object}	error					"Bad request"
+// @Failure		403		{object}	error					"Role not below the own role or permission not held"
+// @Failure		500		{object}	error					"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/roles/{roleID}/permissions	[put]
+func (app *application) setRolePermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	var payload RolePermissionsPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	actor := getAuthUserFromContext(r)
+	outranks, err := app.outranks(ctx, actor, roleID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !outranks {
+		app.forbiddenError(w, r, fmt.Errorf("role %d is not below the role of the user", roleID))
+		return
+	}
+	allowed, err := app.canGrant(ctx, actor, permissionSet(payload.Permissions))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenError(w, r, fmt.Errorf("permissions not held by the user can not be granted"))
+		return
+	}
+
+	roles, err := app.store.Role.GetAll(ctx)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	var before RolePermissionsPayload
+	for _, role := range roles {
+		if role.ID == roleID {
+			before.Permissions = role.Permissions
+		}
+	}
+
+	if err := app.store.Role.SetPermissions(ctx, roleID, payload.Permissions); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("unknown role or permission"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.permissions.invalidate()
+	app.audit.Log(r, auditRolePermissionsSet, AuditTarget{Type: "role", ID: roleID}, before, payload)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Assigns a role
+// @Description	Assigns a role to a user, the user must hold every permission of the role
+// @Tags			admin
+// @Accept			json
+// @Produce		json
+// @Param			userID	path		int					true	"User ID"
+// @Param			payload	body		AssignRolePayload	true	"Role name"
+// @Success		204		{string}	string				"Role assigned"
+// @Failure		400		{object}	error				"Bad request"
+// @Failure		403		{object}	error				"Permission of the role not held by the user"
+// @Failure		404		{object}	error				"User not found"
+// @Failure		500		{object}	error				"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/admin/users/{userID}/role	[put]
+func (app *application) assignRoleHandler(w http.ResponseWriter, r *http.Request) {
+	var payload AssignRolePayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	user := getUserFromContext(r)
+	role, err := app.store.Role.GetByName(ctx, payload.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.badRequestResponse(w, r, fmt.Errorf("unknown role %s", payload.Role))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	// a role granting more than the own one can not be handed out, whatever its level
+	permissions, err := app.rolePermissions(ctx, role.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	allowed, err := app.canGrant(ctx, getAuthUserFromContext(r), permissions)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if !allowed {
+		app.forbiddenError(w, r, fmt.Errorf("role %s grants permissions not held by the user", role.Name))
+		return
+	}
+	if err := app.store.Users.SetRole(ctx, user.ID, role.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+
+	assigned := *user
+	assigned.RoleID = role.ID
+	assigned.Role = *role
+	app.audit.Log(r, auditUserRoleAssign, AuditTarget{Type: "user", ID: user.ID}, user, assigned)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestPermissions(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	t.Run("should not allow a user without the permission on admin endpoints", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/admin/roles", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should grant the permissions of the role", func(t *testing.T) {
+		moderator := &store.User{Role: store.Role{ID: 2}}
+		cases := map[string]bool{
+			permCommentsUpdateAny: true,
+			permPostsUpdateAny:    true,
+			permPostsDeleteAny:    false,
+			permRolesManage:       false,
+		}
+		for permission, expected := range cases {
+			allowed, err := app.hasPermission(context.Background(), moderator, permission)
+			if err != nil {
+				t.Fatalf("could not check permission: %v", err)
+			}
+			if allowed != expected {
+				t.Errorf("expected %s to be %v, got %v", permission, expected, allowed)
+			}
+		}
+	})
+}
+
+func TestRoleGrants(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	// the mock store loads user 3 as an admin and user 4 with the support role, which only
+	// grants users.manage and has no level like every custom role
+	tokenFor := func(t *testing.T, userID int64) string {
+		t.Helper()
+		token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"sub": userID,
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not generate test token: %v", err)
+		}
+		return token
+	}
+	adminToken, supportToken := tokenFor(t, 3), tokenFor(t, 4)
+
+	request := func(t *testing.T, token, method, url, body string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should only assign roles whose permissions the user holds", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, supportToken, http.MethodPut, "/v1/admin/users/10/role", `{"role": "admin"}`))
+		checkResponseCode(t, http.StatusForbidden, request(t, supportToken, http.MethodPut, "/v1/admin/users/10/role", `{"role": "moderator"}`))
+		checkResponseCode(t, http.StatusNoContent, request(t, supportToken, http.MethodPut, "/v1/admin/users/10/role", `{"role": "support"}`))
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodPut, "/v1/admin/users/10/role", `{"role": "moderator"}`))
+		checkResponseCode(t, http.StatusBadRequest, request(t, adminToken, http.MethodPut, "/v1/admin/users/10/role", `{"role": "unknown"}`))
+	})
+	t.Run("should only create roles with permissions the user holds", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, adminToken, http.MethodPost, "/v1/admin/roles", `{"name": "owner", "permissions": ["users.manage", "billing.manage"]}`))
+		checkResponseCode(t, http.StatusCreated, request(t, adminToken, http.MethodPost, "/v1/admin/roles", `{"name": "editor", "permissions": ["posts.update.any"]}`))
+	})
+	t.Run("should only change the permissions of roles below the own one", func(t *testing.T) {
+		checkResponseCode(t, http.StatusForbidden, request(t, adminToken, http.MethodPut, "/v1/admin/roles/3/permissions", `{"permissions": ["users.manage"]}`))
+		checkResponseCode(t, http.StatusForbidden, request(t, adminToken, http.MethodPut, "/v1/admin/roles/2/permissions", `{"permissions": ["billing.manage"]}`))
+		checkResponseCode(t, http.StatusNoContent, request(t, adminToken, http.MethodPut, "/v1/admin/roles/4/permissions", `{"permissions": ["users.manage", "posts.update.any"]}`))
+	})
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"unicode/utf8"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/go-chi/chi/v5"
@@ -17,7 +19,7 @@ const postCtx postKey = "post"
 type CreatePostPayload struct {
 	Title   string   `json:"title" validate:"required,max=100"`
 	Content string   `json:"content" validate:"required,max=1000"`
-	Tags    []string `json:"tags"`
+	Tags    []string `json:"tags" validate:"dive,max=100"`
 }
 
 // @Summary		Creates post
@@ -43,32 +45,49 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	tags, err := normalizePostTags(payload.Tags)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
 	authUser := getAuthUserFromContext(r)
 	post = store.Post{
 		Title:   payload.Title,
 		Content: payload.Content,
-		Tags:    payload.Tags,
+		Tags:    tags,
 		UserID:  authUser.ID,
 	}
 
-	err := app.store.Posts.Create(r.Context(), &post)
+	err = app.store.Posts.Create(r.Context(), &post)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.fanOutPost(post)
 	if err := jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 }
 
+// PostResponse is a post with the first page of its comments
+type PostResponse struct {
+	*store.Post
+	// CommentCount is the number of comments of the post, replies included
+	CommentCount int `json:"comment_count"`
+	// CommentsNextCursor gets the next page from the comments endpoint
+	CommentsNextCursor string `json:"comments_next_cursor"`
+}
+
 // @Summary		get post
-// @Description	get post by post id
+// @Description	get post by post id with the first page of its comments
 // @Tags			posts
 // @Accept			json
 // @Produce		json
-// @Param			id	path		int	true	"Post id"
-// @Success		200	{object}	store.Post
+// @Param			id			path		int		true	"Post id"
+// @Param			comments	query		string	false	"Comment layout, flat (with depth) or tree | default: flat"
+// @Success		200	{object}	PostResponse
 // @Failure		400	{object}	error	"Bad request"
 // @Failure		404	{object}	error	"Post not found"
 // @Failure		500	{object}	error	"Somehting went wrong"
@@ -76,13 +95,29 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 // @Router			/posts/{id}	[get]
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromContext(r)
-	comments, err := app.store.Comments.GetByPostID(r.Context(), post.ID)
+	ctx := r.Context()
+
+	cq := defaultCommentQuery()
+	if r.URL.Query().Get("comments") == "tree" {
+		cq.View = "tree"
+	}
+	page, err := app.commentPage(ctx, post.ID, cq)
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	post.Comments = comments
-	if err := jsonResponse(w, http.StatusOK, post); err != nil {
+	count, err := app.store.Comments.CountByPostID(ctx, post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.Comments = page.Comments
+	response := PostResponse{
+		Post:               post,
+		CommentCount:       count,
+		CommentsNextCursor: page.NextCursor,
+	}
+	if err := jsonResponse(w, http.StatusOK, response); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -111,15 +146,20 @@ func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request
 			return
 		default:
 			app.internalServerError(w, r, err)
+			return
 		}
 	}
+	app.removePost(*post)
+	if getAuthUserFromContext(r).ID != post.UserID {
+		app.audit.Log(r, auditPostDelete, AuditTarget{Type: "post", ID: post.ID}, post, nil)
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
 
 type UpdatePostPayload struct {
 	Title   *string  `json:"title" validate:"omitempty,max=100"`
 	Content *string  `json:"content" validate:"omitempty,max=1000"`
-	Tags    []string `json:"tags"  validate:"omitempty,max=1000"`
+	Tags    []string `json:"tags"  validate:"omitempty,max=1000,dive,max=100"`
 }
 
 // @Summary		update post
@@ -146,6 +186,7 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		app.badRequestResponse(w, r, err)
 		return
 	}
+	before := *post
 	if payload.Content != nil {
 		post.Content = *payload.Content
 	}
@@ -153,7 +194,12 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 		post.Title = *payload.Title
 	}
 	if payload.Tags != nil {
-		post.Tags = payload.Tags
+		tags, err := normalizePostTags(payload.Tags)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		post.Tags = tags
 	}
 	ctx := r.Context()
 	if err := app.updatePost(ctx, post); err != nil {
@@ -166,6 +212,10 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 	}
+	// owners editing their own posts are not audited, moderators are
+	if getAuthUserFromContext(r).ID != post.UserID {
+		app.audit.Log(r, auditPostUpdate, AuditTarget{Type: "post", ID: post.ID}, before, post)
+	}
 	err := jsonResponse(w, http.StatusOK, post)
 	if err != nil {
 		writeJSONError(w, http.StatusInternalServerError, err.Error())
@@ -210,3 +260,14 @@ func (app *application) updatePost(ctx context.Context, post *store.Post) error
 	app.cacheStorage.Users.Delete(ctx, post.ID)
 	return nil
 }
+
+// normalizePostTags normalizes the tags of a post, NFKC can make a tag longer than it was written
+func normalizePostTags(tags []string) ([]string, error) {
+	normalized := store.NormalizeTags(tags)
+	for _, tag := range normalized {
+		if utf8.RuneCountInString(tag) > store.MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, store.MaxTagLength)
+		}
+	}
+	return normalized, nil
+}
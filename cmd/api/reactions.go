@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+// @Summary		Reacts to a post
+// @Description	Sets the reaction of the authenticated user to the post, replacing a previous one
+// @Tags			posts
+// @Produce		json
+// @Param			postID	path		int		true	"Post id"
+// @Param			type	path		string	true	"Reaction type, e.g. like"
+// @Success		204		{string}	string	"Reaction set"
+// @Failure		400		{object}	error	"Unknown reaction type"
+// @Failure		404		{object}	error	"Post not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/reactions/{type}	[put]
+func (app *application) reactToPostHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, err := app.reactionFromPath(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+	if err := app.store.Reactions.Set(r.Context(), post.ID, user.ID, reaction); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Removes a reaction
+// @Description	Removes the reaction of the authenticated user from the post
+// @Tags			posts
+// @Produce		json
+// @Param			postID	path		int		true	"Post id"
+// @Param			type	path		string	true	"Reaction type, e.g. like"
+// @Success		204		{string}	string	"Reaction removed"
+// @Failure		400		{object}	error	"Unknown reaction type"
+// @Failure		404		{object}	error	"Reaction not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/posts/{postID}/reactions/{type}	[delete]
+func (app *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	reaction, err := app.reactionFromPath(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	post := getPostFromContext(r)
+	user := getAuthUserFromContext(r)
+	if err := app.store.Reactions.Delete(r.Context(), post.ID, user.ID, reaction); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *application) reactionFromPath(r *http.Request) (string, error) {
+	reaction := chi.URLParam(r, "type")
+	if !slices.Contains(app.config.reactions.types, reaction) {
+		return "", fmt.Errorf("unknown reaction type %s", reaction)
+	}
+	return reaction, nil
+}
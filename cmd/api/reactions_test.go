@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestReactions(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	react := func(t *testing.T, method, reaction string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, "/v1/posts/1/reactions/"+reaction, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should set a configured reaction", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, react(t, http.MethodPut, "like"))
+	})
+	t.Run("should reject an unknown reaction", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, react(t, http.MethodPut, "dislike"))
+	})
+	t.Run("should remove a reaction", func(t *testing.T) {
+		checkResponseCode(t, http.StatusNoContent, react(t, http.MethodDelete, "love"))
+	})
+}
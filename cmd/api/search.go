@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+)
+
+// searchScopes are the token scopes needed to search each type
+var searchScopes = map[string]string{
+	"posts":    scopePostsRead,
+	"comments": scopePostsRead,
+	"users":    scopeUsersRead,
+}
+
+// SearchPage is a page of search hits, most relevant first
+type SearchPage struct {
+	Data []store.SearchHit `json:"data"`
+	// NextCursor gets the next page, it is empty on the last page
+	NextCursor string `json:"next_cursor"`
+}
+
+// @Summary		Searches
+// @Description	Full text search of posts (title, content and tags), comments or users, most relevant
+// @Description	first. The query supports "quoted phrases", -excluded words and OR, matches are
+// @Description	highlighted with <mark> tags in the HTML escaped snippets
+// @Tags			search
+// @Produce		json
+// @Param			q		query		string	true	"Search query"
+// @Param			type	query		string	false	"posts, comments or users | default: posts"
+// @Param			limit	query		int		false	"Limit | default: 20"
+// @Param			cursor	query		string	false	"next_cursor of the previous page"
+// @Success		200		{object}	SearchPage
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		403		{object}	error	"Forbidden"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/search	[get]
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	sq := store.PaginatedSearchQuery{
+		Type:  "posts",
+		Limit: 20,
+	}
+	sq = sq.Parse(r)
+
+	if err := Validate.Struct(sq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if pat := getPersonalAccessTokenFromContext(r); pat != nil && !pat.HasScope(searchScopes[sq.Type]) {
+		app.forbiddenError(w, r, fmt.Errorf("token is missing scope %s", searchScopes[sq.Type]))
+		return
+	}
+
+	hits, next, err := app.store.Search.Search(r.Context(), sq)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrInvalidCursor):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, SearchPage{Data: hits, NextCursor: next}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
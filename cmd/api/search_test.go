@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	search := func(t *testing.T, query url.Values) int {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, "/v1/search?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should search every type", func(t *testing.T) {
+		for _, searchType := range []string{"posts", "comments", "users"} {
+			code := search(t, url.Values{"q": {`"go routines" -java OR rust`}, "type": {searchType}})
+			checkResponseCode(t, http.StatusOK, code)
+		}
+		cursor := base64.RawURLEncoding.EncodeToString([]byte(`{"rank": 0.5, "id": 10}`))
+		checkResponseCode(t, http.StatusOK, search(t, url.Values{"q": {"go"}, "cursor": {cursor}}))
+	})
+	t.Run("should reject invalid searches", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, search(t, url.Values{}))
+		checkResponseCode(t, http.StatusBadRequest, search(t, url.Values{"q": {"go"}, "type": {"tags"}}))
+		checkResponseCode(t, http.StatusBadRequest, search(t, url.Values{"q": {"go"}, "cursor": {"forged"}}))
+	})
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// cookies of the session mode used by browser clients, the tokens are kept out of reach of scripts
+const (
+	accessTokenCookie  = "access_token"
+	refreshTokenCookie = "refresh_token"
+	// csrfCookie is readable by the frontend which sends it back in csrfHeader (double submit)
+	csrfCookie = "csrf_token"
+	csrfHeader = "X-CSRF-Token"
+)
+
+var errInvalidCSRFToken = errors.New("missing or invalid csrf token")
+
+// cookieSessionRequested reports whether the client asked for the tokens to be set as cookies
+// instead of being returned in the body
+func cookieSessionRequested(r *http.Request) bool {
+	return r.URL.Query().Get("mode") == "cookie"
+}
+
+// sessionResponse sets the tokens as cookies when the client uses the cookie session mode.
+// The returned response holds the csrf token in place of the tokens in that case
+func (app *application) sessionResponse(w http.ResponseWriter, r *http.Request, tokens *TokenResponse) (*TokenResponse, error) {
+	if !cookieSessionRequested(r) {
+		return tokens, nil
+	}
+	csrfToken, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	app.setSessionCookies(w, tokens, csrfToken)
+	return &TokenResponse{ExpiresAt: tokens.ExpiresAt, CSRFToken: csrfToken}, nil
+}
+
+func (app *application) setSessionCookies(w http.ResponseWriter, tokens *TokenResponse, csrfToken string) {
+	refreshExp := app.config.auth.token.refreshExp
+	http.SetCookie(w, app.sessionCookie(accessTokenCookie, tokens.Token, "/v1", time.Until(time.Unix(tokens.ExpiresAt, 0)), true))
+	// the refresh token is only sent to the endpoints which need it
+	http.SetCookie(w, app.sessionCookie(refreshTokenCookie, tokens.RefreshToken, "/v1/authentication", refreshExp, true))
+	http.SetCookie(w, app.sessionCookie(csrfCookie, csrfToken, "/", refreshExp, false))
+}
+
+func (app *application) clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, app.sessionCookie(accessTokenCookie, "", "/v1", -1, true))
+	http.SetCookie(w, app.sessionCookie(refreshTokenCookie, "", "/v1/authentication", -1, true))
+	http.SetCookie(w, app.sessionCookie(csrfCookie, "", "/", -1, false))
+}
+
+// sessionCookie builds a session cookie, a negative maxAge deletes it
+func (app *application) sessionCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	cookie := &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   app.config.auth.session.cookieDomain,
+		HttpOnly: httpOnly,
+		Secure:   app.config.auth.session.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	}
+	if maxAge < 0 {
+		cookie.MaxAge = -1
+	} else {
+		cookie.MaxAge = int(maxAge.Seconds())
+		cookie.Expires = time.Now().Add(maxAge)
+	}
+	return cookie
+}
+
+// checkCSRF compares the csrf header with the csrf cookie of state changing requests
+func checkCSRF(r *http.Request) error {
+	if isSafeMethod(r.Method) {
+		return nil
+	}
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return errInvalidCSRFToken
+	}
+	header := r.Header.Get(csrfHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return errInvalidCSRFToken
+	}
+	return nil
+}
+
+// isSafeMethod reports whether requests of the method only read state
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
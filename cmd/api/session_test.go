@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCookieSession(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	newRequest := func(t *testing.T, method, url string) *http.Request {
+		t.Helper()
+		req, err := http.NewRequest(method, url, strings.NewReader(`{"username": "new_name"}`))
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.AddCookie(&http.Cookie{Name: accessTokenCookie, Value: testToken})
+		req.AddCookie(&http.Cookie{Name: csrfCookie, Value: "csrf-value"})
+		return req
+	}
+
+	t.Run("should authenticate safe requests with the access token cookie", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/users/10"), mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+	t.Run("should reject state changes without the csrf header", func(t *testing.T) {
+		rr := executeRequest(newRequest(t, http.MethodPatch, "/v1/users/me"), mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("should reject state changes with a wrong csrf header", func(t *testing.T) {
+		req := newRequest(t, http.MethodPatch, "/v1/users/me")
+		req.Header.Set(csrfHeader, "other-value")
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("should allow state changes with the csrf header", func(t *testing.T) {
+		req := newRequest(t, http.MethodPatch, "/v1/users/me")
+		req.Header.Set(csrfHeader, "csrf-value")
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+}
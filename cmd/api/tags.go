@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type tagKey string
+
+const tagCtx tagKey = "tag"
+
+// trending windows are at least an hour and at most 30 days
+const (
+	minTrendingWindow = time.Hour
+	maxTrendingWindow = time.Hour * 24 * 30
+)
+
+// @Summary		get tag posts
+// @Description	get the posts with the tag, paged and filtered like the feed
+// @Tags			tags
+// @Accept			json
+// @Produce		json
+// @Param			tag			path		string	true	"Tag, normalized before the lookup"
+// @Param			limit		query		int		false	"Feed limit  | default: 20"
+// @Param			offset		query		int		false	"Feed offset | default: 0"
+// @Param			cursor		query		string	false	"next_cursor or prev_cursor of a page"
+// @Param			sort_by		query		string	false	"Feed sort_by (title/content/created_at/popular) | default : created_at"
+// @Param			sort_order	query		string	false	"Feed sort_order(asc/desc) | default | desc"
+// @Param			search		query		string	false	"Feed search by title/content  "
+// @Param			since		query		string	false	"From time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			until		query		string	false	"To time (RFC 3339, 2006-01-02 15:04:05, 2006-01-02) or duration ago (24h, 7d)"
+// @Param			tz			query		string	false	"Time zone of times without an offset, e.g. Europe/Berlin | default: UTC"
+// @Success		200			{object}	[]store.PostWithMetadata
+// @Success		200			{object}	FeedPage
+// @Failure		400			{object}	error	"Bad request"
+// @Failure		404			{object}	error	"Tag not found"
+// @Failure		500			{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/tags/{tag}/posts	[get]
+func (app *application) getTagPostsHandler(w http.ResponseWriter, r *http.Request) {
+	fq, ok := app.readFeedQuery(w, r)
+	if !ok {
+		return
+	}
+	tag := getTagFromContext(r)
+	feeds, cursors, err := app.store.Posts.GetTagPosts(r.Context(), getAuthUserFromContext(r).ID, tag.ID, fq)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.feedResponse(w, r, fq, feeds, cursors)
+}
+
+// @Summary		Follows a tag
+// @Description	Follows a tag, posts with the tag show up in the feed
+// @Tags			tags
+// @Produce		json
+// @Param			tag	path		string	true	"Tag"
+// @Success		201	{object}	store.Tag
+// @Failure		404	{object}	error	"Tag not found"
+// @Failure		409	{object}	error	"Tag already followed"
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/tags/{tag}/follow	[put]
+func (app *application) followTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := getTagFromContext(r)
+	if err := app.store.Tags.Follow(r.Context(), getAuthUserFromContext(r).ID, tag.ID); err != nil {
+		switch {
+		case errors.Is(err, store.ErrorConflict):
+			app.conflictError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if err := jsonResponse(w, http.StatusCreated, tag); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Unfollows a tag
+// @Description	Unfollows a tag
+// @Tags			tags
+// @Produce		json
+// @Param			tag	path		string	true	"Tag"
+// @Success		204	{string}	string	"Tag unfollowed"
+// @Failure		404	{object}	error	"Tag not found"
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/tags/{tag}/unfollow	[put]
+func (app *application) unfollowTagHandler(w http.ResponseWriter, r *http.Request) {
+	tag := getTagFromContext(r)
+	if err := app.store.Tags.Unfollow(r.Context(), getAuthUserFromContext(r).ID, tag.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary		Lists trending tags
+// @Description	Lists the tags whose use grew the most in the window compared to the window before it
+// @Tags			tags
+// @Produce		json
+// @Param			window	query		string	false	"Window, 1h to 30d | default: 24h"
+// @Param			limit	query		int		false	"Limit | default: 10"
+// @Success		200		{object}	[]store.TrendingTag
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/tags/trending	[get]
+func (app *application) getTrendingTagsHandler(w http.ResponseWriter, r *http.Request) {
+	tq := store.TrendingTagsQuery{
+		Window: "24h",
+		Limit:  10,
+	}
+	tq = tq.Parse(r)
+
+	if err := Validate.Struct(tq); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	window, err := store.ParseDuration(tq.Window)
+	if err != nil || window < minTrendingWindow || window > maxTrendingWindow {
+		app.badRequestResponse(w, r, fmt.Errorf("window must be a duration from %s to %s", minTrendingWindow, maxTrendingWindow))
+		return
+	}
+
+	tags, err := app.store.Tags.GetTrending(r.Context(), window, tq.Limit)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, tags); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// tagContextMiddleware loads the tag of the route by its normalized name
+func (app *application) tagContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag, err := app.store.Tags.GetByName(r.Context(), store.NormalizeTag(chi.URLParam(r, "tag")))
+		if err != nil {
+			switch {
+			case errors.Is(err, store.ErrorNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+		ctx := context.WithValue(r.Context(), tagCtx, tag)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func getTagFromContext(r *http.Request) *store.Tag {
+	tag, _ := r.Context().Value(tagCtx).(*store.Tag)
+	return tag
+}
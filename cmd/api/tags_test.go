@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestTags(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	do := func(t *testing.T, method, path string) int {
+		t.Helper()
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should find the tag by its normalized name", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/tags/GO/posts"))
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/tags/%23go/posts?cursor="))
+		checkResponseCode(t, http.StatusNotFound, do(t, http.MethodGet, "/v1/tags/rust/posts"))
+	})
+	t.Run("should reject tags longer than the column once normalized", func(t *testing.T) {
+		post := func(t *testing.T, tag string) int {
+			t.Helper()
+			body := fmt.Sprintf(`{"title": "title", "content": "content", "tags": [%q]}`, tag)
+			req, err := http.NewRequest(http.MethodPost, "/v1/posts", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+			return executeRequest(req, mux).Code
+		}
+		checkResponseCode(t, http.StatusCreated, post(t, strings.Repeat("a", 100)))
+		// each of the 6 characters is 18 characters in NFKC
+		checkResponseCode(t, http.StatusBadRequest, post(t, strings.Repeat("\ufdfa", 6)))
+	})
+	t.Run("should follow and unfollow a tag", func(t *testing.T) {
+		checkResponseCode(t, http.StatusCreated, do(t, http.MethodPut, "/v1/tags/go/follow"))
+		checkResponseCode(t, http.StatusNoContent, do(t, http.MethodPut, "/v1/tags/go/unfollow"))
+	})
+	t.Run("should list the trending tags of a window", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/tags/trending"))
+		checkResponseCode(t, http.StatusOK, do(t, http.MethodGet, "/v1/tags/trending?window=7d&limit=5"))
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/tags/trending?window=1m"))
+		checkResponseCode(t, http.StatusBadRequest, do(t, http.MethodGet, "/v1/tags/trending?window=90d"))
+	})
+}
@@ -4,8 +4,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/auth"
+	"github.com/Shadowcyng/goSocial/internal/mailer"
+	"github.com/Shadowcyng/goSocial/internal/ratelimiter"
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/Shadowcyng/goSocial/internal/store/cache"
 	"go.uber.org/zap"
@@ -19,10 +22,19 @@ func NewTestApplication(t *testing.T) *application {
 	cacheMockStore := cache.NewMockCache()
 	testAuth := &auth.TestAuthenticator{}
 	return &application{
+		config: config{
+			reactions: reactionConfig{types: []string{"like", "love"}},
+			comments:  commentConfig{maxDepth: 2, threadReplies: 20},
+			feed:      feedConfig{cursorSecret: "test"},
+		},
 		logger:        logger,
+		mailer:        &mailer.MockMailer{},
 		store:         mockStore,
 		cacheStorage:  cacheMockStore,
+		resendLimiter: ratelimiter.NewFixedWindowLimiter(3, time.Hour),
 		authenticator: testAuth,
+		permissions:   newPermissionCache(time.Minute),
+		audit:         NewAuditLogger(mockStore, logger),
 	}
 }
 
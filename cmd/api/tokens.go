@@ -0,0 +1,145 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-chi/chi/v5"
+)
+
+type patKey string
+
+const patCtx patKey = "personalAccessToken"
+
+const personalAccessTokenPrefix = "gsp_"
+
+// scopes a personal access token can be granted
+const (
+	scopePostsRead      = "posts:read"
+	scopePostsWrite     = "posts:write"
+	scopeCommentsWrite  = "comments:write"
+	scopeReactionsWrite = "reactions:write"
+	scopeFeedRead       = "feed:read"
+	scopeUsersRead      = "users:read"
+	scopeUsersWrite     = "users:write"
+)
+
+type CreatePersonalAccessTokenPayload struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,oneof=posts:read posts:write comments:write reactions:write feed:read users:read users:write"`
+	// ExpiresIn is the lifetime in days, tokens without it never expire
+	ExpiresIn int `json:"expires_in" validate:"omitempty,gte=1,lte=365"`
+}
+
+type PersonalAccessTokenWithToken struct {
+	*store.PersonalAccessToken
+	Token string `json:"token"`
+}
+
+// @Summary		Creates a personal access token
+// @Description	Creates a named token with scopes for bots and integrations, the token is only returned once
+// @Tags			tokens
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		CreatePersonalAccessTokenPayload	true	"Token name, scopes and expiry"
+// @Success		201		{object}	PersonalAccessTokenWithToken
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/tokens	[post]
+func (app *application) createPersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload CreatePersonalAccessTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	plainToken := personalAccessTokenPrefix + hex.EncodeToString(b)
+
+	token := &store.PersonalAccessToken{
+		UserID: getAuthUserFromContext(r).ID,
+		Name:   payload.Name,
+		Scopes: payload.Scopes,
+	}
+	if payload.ExpiresIn > 0 {
+		exp := time.Now().Add(time.Hour * 24 * time.Duration(payload.ExpiresIn))
+		token.ExpiresAt = &exp
+	}
+
+	if err := app.store.PersonalAccessTokens.Create(r.Context(), token, hashToken(plainToken)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	app.audit.Log(r, auditTokenCreate, AuditTarget{Type: "personal_access_token", ID: token.ID}, nil, token)
+	if err := jsonResponse(w, http.StatusCreated, PersonalAccessTokenWithToken{PersonalAccessToken: token, Token: plainToken}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Lists personal access tokens
+// @Description	Lists the personal access tokens of the authenticated user
+// @Tags			tokens
+// @Produce		json
+// @Success		200	{object}	[]store.PersonalAccessToken
+// @Failure		500	{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/tokens	[get]
+func (app *application) getPersonalAccessTokensHandler(w http.ResponseWriter, r *http.Request) {
+	tokens, err := app.store.PersonalAccessTokens.GetByUserID(r.Context(), getAuthUserFromContext(r).ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if err := jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Revokes a personal access token
+// @Description	Deletes a personal access token of the authenticated user
+// @Tags			tokens
+// @Produce		json
+// @Param			tokenID	path		int		true	"Token ID"
+// @Success		204		{string}	string	"Token revoked"
+// @Failure		404		{object}	error	"Token not found"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me/tokens/{tokenID}	[delete]
+func (app *application) deletePersonalAccessTokenHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "tokenID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	err = app.store.PersonalAccessTokens.Delete(r.Context(), getAuthUserFromContext(r).ID, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, store.ErrorNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.audit.Log(r, auditTokenDelete, AuditTarget{Type: "personal_access_token", ID: id}, nil, nil)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getPersonalAccessTokenFromContext(r *http.Request) *store.PersonalAccessToken {
+	pat, _ := r.Context().Value(patCtx).(*store.PersonalAccessToken)
+	return pat
+}
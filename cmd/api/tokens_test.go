@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestPersonalAccessTokenScopes(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	// the mock store grants every personal access token the users:read scope only
+	testToken := personalAccessTokenPrefix + "test"
+
+	t.Run("should allow routes within the token scopes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/10", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+	t.Run("should forbid routes outside the token scopes", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/users/10/follow", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+	t.Run("should not allow tokens to manage the account", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/me/tokens", nil)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -3,7 +3,13 @@ package main
 import (
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // go test
@@ -34,3 +40,65 @@ func TestGetUser(t *testing.T) {
 		checkResponseCode(t, http.StatusOK, rr.Code)
 	})
 }
+
+func TestUpdateMe(t *testing.T) {
+	app := NewTestApplication(t)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatalf("could not generate test token: %v", err)
+	}
+
+	t.Run("should allow authenticated user to change username", func(t *testing.T) {
+		body := strings.NewReader(`{"username": "new_name"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+	t.Run("should require current password to change email", func(t *testing.T) {
+		body := strings.NewReader(`{"email": "new@example.com"}`)
+		req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", body)
+		if err != nil {
+			t.Fatalf("could not create request: %v", err)
+		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", testToken))
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("should apply no change when one of them fails", func(t *testing.T) {
+		// the mock store loads user 5 with the password "password"
+		token, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"sub": int64(5),
+			"exp": time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not generate test token: %v", err)
+		}
+		update := func(t *testing.T, email string) int {
+			t.Helper()
+			body := fmt.Sprintf(`{"username": "new_name", "current_password": "password", "new_password": "new-password", "email": %q}`, email)
+			req, err := http.NewRequest(http.MethodPatch, "/v1/users/me", strings.NewReader(body))
+			if err != nil {
+				t.Fatalf("could not create request: %v", err)
+			}
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			return executeRequest(req, mux).Code
+		}
+		users := app.store.Users.(*store.MockUserStore)
+
+		// every email but unknown@example.com belongs to a user in the mock store
+		checkResponseCode(t, http.StatusBadRequest, update(t, "taken@example.com"))
+		if slices.Contains(users.Updated, 5) {
+			t.Errorf("expected the profile not to be updated")
+		}
+		checkResponseCode(t, http.StatusOK, update(t, "unknown@example.com"))
+		if !slices.Contains(users.Updated, 5) {
+			t.Errorf("expected the profile to be updated")
+		}
+	})
+}
@@ -3,11 +3,15 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
+	"github.com/Shadowcyng/goSocial/internal/mailer"
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type userKey string
@@ -65,6 +69,7 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 			return
 		}
 	}
+	app.invalidateTimeline(ctx, authUser.ID)
 
 	if err := jsonResponse(w, http.StatusCreated, followedUser); err != nil {
 		app.internalServerError(w, r, err)
@@ -93,6 +98,7 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		app.internalServerError(w, r, err)
 		return
 	}
+	app.invalidateTimeline(ctx, authUser.ID)
 
 	if err := jsonResponse(w, http.StatusCreated, followerUser); err != nil {
 		app.internalServerError(w, r, err)
@@ -127,6 +133,158 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type UpdateUserPayload struct {
+	Username        *string `json:"username" validate:"omitempty,min=3,max=100"`
+	Email           *string `json:"email" validate:"omitempty,email,max=255"`
+	CurrentPassword string  `json:"current_password" validate:"omitempty,max=72"`
+	NewPassword     *string `json:"new_password" validate:"omitempty,min=3,max=72"`
+}
+
+// @Summary		Update own profile
+// @Description	Changes the username of the authenticated user, password and email changes require the current password.
+// @Description	A new email only takes effect once it's confirmed through the link sent to it
+// @Tags			users
+// @Accept			json
+// @Produce		json
+// @Param			payload	body		UpdateUserPayload	true	"Profile changes"
+// @Success		200		{object}	store.User
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		401		{object}	error	"Unauthorized"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @security		ApiKeyAuth
+// @Router			/users/me	[patch]
+func (app *application) updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	var payload UpdateUserPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+	if err := Validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	authUser := getAuthUserFromContext(r)
+	// cached users don't carry the password hash, always read the user from db
+	user, err := app.store.Users.GetById(ctx, authUser.ID)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.unauthorizedError(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if payload.NewPassword != nil || payload.Email != nil {
+		if payload.CurrentPassword == "" {
+			app.badRequestResponse(w, r, fmt.Errorf("current_password is required to change password or email"))
+			return
+		}
+		if err := user.Password.Validate(payload.CurrentPassword); err != nil {
+			app.invalidCredentials(w, r, err)
+			return
+		}
+	}
+
+	// everything is checked before the changes are saved together, a failing change leaves the
+	// profile as it was
+	var changes store.ProfileChanges
+	if payload.Username != nil {
+		user.Username = *payload.Username
+	}
+	if payload.NewPassword != nil {
+		if err := user.Password.Set(*payload.NewPassword); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+		changes.Password = true
+	}
+	var emailToken string
+	if payload.Email != nil && !strings.EqualFold(*payload.Email, user.Email) {
+		_, err := app.store.Users.GetByEmail(ctx, *payload.Email)
+		switch {
+		case err == nil:
+			app.badRequestResponse(w, r, store.ErrorDuplicateEmail)
+			return
+		case !errors.Is(err, store.ErrorNotFound):
+			app.internalServerError(w, r, err)
+			return
+		}
+		emailToken = uuid.New().String()
+		changes.Email = *payload.Email
+		changes.EmailToken = hashToken(emailToken)
+		changes.EmailExp = app.config.mail.exp
+	}
+
+	if err := app.store.Users.UpdateProfile(ctx, user, changes); err != nil {
+		switch err {
+		case store.ErrorDuplicateUsername:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	if changes.Password {
+		app.audit.Log(r, auditUserPasswordChange, AuditTarget{Type: "user", ID: user.ID}, nil, nil)
+	}
+	if changes.Email != "" {
+		if err := app.sendEmailChange(user, changes.Email, emailToken); err != nil {
+			app.logger.Errorw("error sending email change confirmation", "error", err)
+		}
+	}
+
+	app.deleteUserCache(ctx, user.ID)
+	if err := jsonResponse(w, http.StatusOK, user); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// @Summary		Confirm email change
+// @Description	Confirms the new email of a user by the token sent to that email
+// @Tags			users
+// @Produce		json
+// @Param			token	path		string	true	"Confirmation token"
+// @Success		204		{string}	string	"Email changed"
+// @Failure		400		{object}	error	"Bad request"
+// @Failure		500		{object}	error	"Somehting went wrong"
+// @Router			/users/email/confirm/{token} [put]
+func (app *application) confirmEmailHandler(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	ctx := r.Context()
+	user, err := app.store.Users.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		switch err {
+		case store.ErrorNotFound:
+			app.badRequestResponse(w, r, err)
+		case store.ErrorDuplicateEmail:
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+	app.deleteUserCache(ctx, user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// sendEmailChange sends the confirmation link of an email change to the new address
+func (app *application) sendEmailChange(user *store.User, email string, plainToken string) error {
+	confirmationURL := fmt.Sprintf("%s/confirm-email/%s", app.config.frontendURL, plainToken)
+	isProdEnv := app.config.env == "production"
+	vars := struct {
+		Username        string
+		ConfirmationURL string
+	}{
+		Username:        user.Username,
+		ConfirmationURL: confirmationURL,
+	}
+	return app.mailer.Send(mailer.EmailChangeTemplate, user.Username, email, vars, !isProdEnv)
+}
+
 func (app *application) userContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		idParam := chi.URLParam(r, "userID")
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+token bytea PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_id ON refresh_tokens (user_id);
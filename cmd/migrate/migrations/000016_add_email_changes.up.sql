@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS email_changes (
+token bytea PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+email citext NOT NULL,
+expiry TIMESTAMP(0) WITH TIME ZONE NOT NULL
+);
@@ -0,0 +1,13 @@
+ALTER TABLE users
+ADD COLUMN totp_secret TEXT,
+ADD COLUMN totp_enabled BOOLEAN NOT NULL DEFAULT FALSE,
+ADD COLUMN totp_last_step BIGINT;
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+code_hash bytea NOT NULL,
+used_at TIMESTAMP(0) WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS personal_access_tokens (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+name VARCHAR(100) NOT NULL,
+token bytea NOT NULL UNIQUE,
+scopes VARCHAR(50) [] NOT NULL DEFAULT '{}',
+expires_at TIMESTAMP(0) WITH TIME ZONE,
+last_used_at TIMESTAMP(0) WITH TIME ZONE,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_personal_access_tokens_user_id ON personal_access_tokens (user_id);
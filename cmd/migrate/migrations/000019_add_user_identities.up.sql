@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS user_identities (
+id bigserial PRIMARY KEY,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+provider VARCHAR(50) NOT NULL,
+subject VARCHAR(255) NOT NULL,
+email citext NOT NULL,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+UNIQUE (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS permissions (
+id bigserial PRIMARY KEY,
+name VARCHAR(100) NOT NULL UNIQUE,
+description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+role_id bigint NOT NULL REFERENCES roles(id) ON DELETE CASCADE,
+permission_id bigint NOT NULL REFERENCES permissions(id) ON DELETE CASCADE,
+PRIMARY KEY (role_id, permission_id)
+);
+
+INSERT INTO permissions (name, description)
+VALUES
+('posts.update.any', 'Update the posts of other users'),
+('posts.delete.any', 'Delete the posts of other users'),
+('users.manage', 'Unlock users and assign their roles'),
+('roles.manage', 'Create roles and change their permissions');
+
+-- keep the access the seeded roles had through their level
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'moderator' AND permissions.name = 'posts.update.any';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin';
@@ -0,0 +1,3 @@
+ALTER TABLE users
+DROP COLUMN IF EXISTS suspended_until,
+DROP COLUMN IF EXISTS suspension_reason;
\ No newline at end of file
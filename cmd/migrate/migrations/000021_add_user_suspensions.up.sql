@@ -0,0 +1,3 @@
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN suspension_reason TEXT;
\ No newline at end of file
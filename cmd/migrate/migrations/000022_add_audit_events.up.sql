@@ -0,0 +1,34 @@
+CREATE TABLE IF NOT EXISTS audit_events (
+id bigserial PRIMARY KEY,
+-- no foreign keys, events outlive the users they mention
+actor_id bigint,
+action VARCHAR(100) NOT NULL,
+target_type VARCHAR(50) NOT NULL,
+target_id bigint,
+ip VARCHAR(64) NOT NULL DEFAULT '',
+request_id VARCHAR(100) NOT NULL DEFAULT '',
+diff jsonb NOT NULL DEFAULT '{}',
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events (actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events (target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events (created_at);
+
+-- the log is append only
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+BEFORE UPDATE OR DELETE ON audit_events
+FOR EACH ROW EXECUTE FUNCTION audit_events_append_only();
+
+INSERT INTO permissions (name, description)
+VALUES ('audit.read', 'Read the audit log');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'audit.read';
@@ -0,0 +1,6 @@
+INSERT INTO permissions (name, description)
+VALUES ('users.impersonate', 'Act as another user for support');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name = 'users.impersonate';
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS post_reactions;
+
+DROP FUNCTION IF EXISTS post_reactions_count;
+
+ALTER TABLE posts
+DROP COLUMN IF EXISTS reaction_counts;
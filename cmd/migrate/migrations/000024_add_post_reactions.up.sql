@@ -0,0 +1,35 @@
+-- a user has one reaction per post, the allowed types are configured in the api
+CREATE TABLE IF NOT EXISTS post_reactions (
+post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+type VARCHAR(20) NOT NULL,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions (user_id);
+
+-- counts per type are kept on the post so the feed does not aggregate reactions
+ALTER TABLE posts
+ADD COLUMN reaction_counts jsonb NOT NULL DEFAULT '{}';
+
+CREATE OR REPLACE FUNCTION post_reactions_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE posts SET reaction_counts = CASE
+            WHEN COALESCE((reaction_counts->>OLD.type)::INT, 0) <= 1 THEN reaction_counts - OLD.type
+            ELSE jsonb_set(reaction_counts, ARRAY[OLD.type], to_jsonb((reaction_counts->>OLD.type)::INT - 1))
+        END
+        WHERE id = OLD.post_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE posts SET reaction_counts = jsonb_set(reaction_counts, ARRAY[NEW.type], to_jsonb(COALESCE((reaction_counts->>NEW.type)::INT, 0) + 1))
+        WHERE id = NEW.post_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_reactions_count
+AFTER INSERT OR UPDATE OF type OR DELETE ON post_reactions
+FOR EACH ROW EXECUTE FUNCTION post_reactions_count();
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name IN ('comments.update.any', 'comments.delete.any');
+
+ALTER TABLE comments
+DROP COLUMN IF EXISTS removed_at,
+DROP COLUMN IF EXISTS edited_at;
@@ -0,0 +1,17 @@
+-- removed comments stay as tombstones so their replies keep their parent
+ALTER TABLE comments
+ADD COLUMN edited_at TIMESTAMP(0) WITH TIME ZONE,
+ADD COLUMN removed_at TIMESTAMP(0) WITH TIME ZONE;
+
+INSERT INTO permissions (name, description)
+VALUES
+('comments.update.any', 'Update the comments of other users'),
+('comments.delete.any', 'Remove the comments of other users');
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'moderator' AND permissions.name = 'comments.delete.any';
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'admin' AND permissions.name IN ('comments.update.any', 'comments.delete.any');
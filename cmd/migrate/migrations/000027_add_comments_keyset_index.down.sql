@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_comments_post_id_id;
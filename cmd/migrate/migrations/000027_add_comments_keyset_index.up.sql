@@ -0,0 +1,2 @@
+-- pages of top level comments are read by id from a cursor
+CREATE INDEX IF NOT EXISTS idx_comments_post_id_id ON comments (post_id, id) WHERE parent_id IS NULL;
@@ -0,0 +1,5 @@
+-- followers of a user are looked up by follower_id when posts are fanned out
+CREATE INDEX IF NOT EXISTS idx_followers_follower_id ON followers (follower_id);
+
+-- timelines are rebuilt from the latest posts of every followed user
+CREATE INDEX IF NOT EXISTS idx_posts_user_id_created_at ON posts (user_id, created_at DESC);
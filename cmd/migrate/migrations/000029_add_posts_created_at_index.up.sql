@@ -0,0 +1,2 @@
+-- time ranges and the explore timeline scan posts by creation time
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts (created_at DESC, id DESC);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_users_search;
+DROP INDEX IF EXISTS idx_comments_search;
+DROP INDEX IF EXISTS idx_posts_search;
+
+ALTER TABLE users DROP COLUMN IF EXISTS search;
+ALTER TABLE comments DROP COLUMN IF EXISTS search;
+ALTER TABLE posts DROP COLUMN IF EXISTS search;
+
+DROP FUNCTION IF EXISTS tags_to_text;
@@ -0,0 +1,25 @@
+-- array_to_string is only stable, generated columns need an immutable expression
+CREATE OR REPLACE FUNCTION tags_to_text(tags VARCHAR(100)[]) RETURNS TEXT
+LANGUAGE SQL IMMUTABLE PARALLEL SAFE AS $$
+    SELECT COALESCE(array_to_string(tags, ' '), '')
+$$;
+
+-- titles rank above the content, the content above the tags
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', COALESCE(title, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(content, '')), 'B') ||
+    setweight(to_tsvector('simple', tags_to_text(tags)), 'C')
+) STORED;
+
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    to_tsvector('english', COALESCE(content, ''))
+) STORED;
+
+-- usernames are not words, they are not stemmed
+ALTER TABLE users ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+    to_tsvector('simple', username)
+) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_posts_search ON posts USING gin (search);
+CREATE INDEX IF NOT EXISTS idx_comments_search ON comments USING gin (search);
+CREATE INDEX IF NOT EXISTS idx_users_search ON users USING gin (search);
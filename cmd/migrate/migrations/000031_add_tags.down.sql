@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS post_tags_count ON post_tags;
+DROP FUNCTION IF EXISTS post_tags_count;
+DROP TRIGGER IF EXISTS posts_sync_tags ON posts;
+DROP FUNCTION IF EXISTS posts_sync_tags;
+
+DROP TABLE IF EXISTS tag_follows;
+DROP TABLE IF EXISTS post_tags;
+DROP TABLE IF EXISTS tags;
@@ -0,0 +1,85 @@
+-- existing tags are normalized like the api does: NFKC, lower case, without a leading #
+UPDATE posts SET tags = ARRAY(
+    SELECT DISTINCT lower(normalize(ltrim(trim(t), '#'), NFKC))
+    FROM unnest(tags) t
+    WHERE ltrim(trim(t), '#') <> ''
+)
+WHERE tags IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS tags (
+id bigserial PRIMARY KEY,
+name VARCHAR(100) NOT NULL UNIQUE,
+usage_count INT NOT NULL DEFAULT 0,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- created_at is when the tag was put on the post, trending tags are counted from it
+CREATE TABLE IF NOT EXISTS post_tags (
+post_id bigint NOT NULL REFERENCES posts(id) ON DELETE CASCADE,
+tag_id bigint NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+PRIMARY KEY (post_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_tags_tag_id ON post_tags (tag_id);
+CREATE INDEX IF NOT EXISTS idx_post_tags_created_at ON post_tags (created_at);
+
+CREATE TABLE IF NOT EXISTS tag_follows (
+user_id bigint NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+tag_id bigint NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+created_at TIMESTAMP(0) WITH TIME ZONE NOT NULL DEFAULT NOW(),
+PRIMARY KEY (user_id, tag_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_tag_follows_tag_id ON tag_follows (tag_id);
+
+INSERT INTO tags (name)
+SELECT DISTINCT unnest(tags) FROM posts
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO post_tags (post_id, tag_id, created_at)
+SELECT p.id, t.id, p.created_at
+FROM posts p
+JOIN tags t ON t.name = ANY(p.tags)
+ON CONFLICT DO NOTHING;
+
+UPDATE tags SET usage_count = (SELECT COUNT(*) FROM post_tags WHERE tag_id = tags.id);
+
+-- posts.tags stays the source of truth, post_tags follows it
+CREATE OR REPLACE FUNCTION posts_sync_tags() RETURNS trigger AS $$
+BEGIN
+    INSERT INTO tags (name)
+    SELECT DISTINCT unnest(NEW.tags)
+    ON CONFLICT (name) DO NOTHING;
+
+    DELETE FROM post_tags pt
+    USING tags t
+    WHERE pt.post_id = NEW.id AND t.id = pt.tag_id AND NOT (t.name = ANY(COALESCE(NEW.tags, '{}')));
+
+    INSERT INTO post_tags (post_id, tag_id, created_at)
+    SELECT NEW.id, t.id, CASE WHEN TG_OP = 'INSERT' THEN NEW.created_at ELSE NOW() END
+    FROM tags t
+    WHERE t.name = ANY(NEW.tags)
+    ON CONFLICT DO NOTHING;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER posts_sync_tags
+AFTER INSERT OR UPDATE OF tags ON posts
+FOR EACH ROW EXECUTE FUNCTION posts_sync_tags();
+
+CREATE OR REPLACE FUNCTION post_tags_count() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        UPDATE tags SET usage_count = usage_count + 1 WHERE id = NEW.tag_id;
+    ELSE
+        UPDATE tags SET usage_count = usage_count - 1 WHERE id = OLD.tag_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER post_tags_count
+AFTER INSERT OR DELETE ON post_tags
+FOR EACH ROW EXECUTE FUNCTION post_tags_count();
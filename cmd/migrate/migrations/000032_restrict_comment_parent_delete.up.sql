@@ -0,0 +1,5 @@
+-- replies are never deleted with their parent, comments with replies become tombstones instead.
+-- NO ACTION is checked at the end of the statement, so whole threads can still be deleted at once
+ALTER TABLE comments
+DROP CONSTRAINT IF EXISTS comments_parent_id_fkey,
+ADD CONSTRAINT comments_parent_id_fkey FOREIGN KEY (parent_id) REFERENCES comments(id) ON DELETE NO ACTION;
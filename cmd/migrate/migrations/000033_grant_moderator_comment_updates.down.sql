@@ -0,0 +1,4 @@
+DELETE FROM role_permissions
+USING roles, permissions
+WHERE role_permissions.role_id = roles.id AND role_permissions.permission_id = permissions.id
+AND roles.name = 'moderator' AND permissions.name = 'comments.update.any';
@@ -0,0 +1,4 @@
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id FROM roles, permissions
+WHERE roles.name = 'moderator' AND permissions.name = 'comments.update.any'
+ON CONFLICT DO NOTHING;
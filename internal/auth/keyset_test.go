@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeKey(t *testing.T, dir, kid string, key any) {
+	t.Helper()
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("could not marshal key: %v", err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0600); err != nil {
+		t.Fatalf("could not write key: %v", err)
+	}
+}
+
+func TestKeySetAuthenticator(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %v", err)
+	}
+	writeKey(t, dir, "2024-01", rsaKey)
+
+	claims := jwt.MapClaims{
+		"sub": 1,
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iss": "test",
+		"aud": "test",
+	}
+
+	old, err := NewKeySetAuthenticator(dir, "", "test", "test")
+	if err != nil {
+		t.Fatalf("could not create authenticator: %v", err)
+	}
+	oldToken, err := old.GenerateToken(claims)
+	if err != nil {
+		t.Fatalf("could not generate token: %v", err)
+	}
+
+	// rotate to a new ed25519 key
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("could not generate ed25519 key: %v", err)
+	}
+	writeKey(t, dir, "2024-02", edKey)
+	rotated, err := NewKeySetAuthenticator(dir, "", "test", "test")
+	if err != nil {
+		t.Fatalf("could not create authenticator: %v", err)
+	}
+
+	t.Run("should sign with the active key", func(t *testing.T) {
+		token, err := rotated.GenerateToken(claims)
+		if err != nil {
+			t.Fatalf("could not generate token: %v", err)
+		}
+		parsed, err := rotated.ValidateToken(token)
+		if err != nil {
+			t.Fatalf("expected token to be valid, got %v", err)
+		}
+		if parsed.Header["kid"] != "2024-02" || parsed.Method.Alg() != "EdDSA" {
+			t.Errorf("expected EdDSA token with kid 2024-02, got %v %v", parsed.Method.Alg(), parsed.Header["kid"])
+		}
+	})
+	t.Run("should accept tokens signed by a previous key", func(t *testing.T) {
+		if _, err := rotated.ValidateToken(oldToken); err != nil {
+			t.Errorf("expected token to be valid, got %v", err)
+		}
+	})
+	t.Run("should reject tokens signed by a removed key", func(t *testing.T) {
+		if err := os.Remove(filepath.Join(dir, "2024-01.pem")); err != nil {
+			t.Fatal(err)
+		}
+		retired, err := NewKeySetAuthenticator(dir, "", "test", "test")
+		if err != nil {
+			t.Fatalf("could not create authenticator: %v", err)
+		}
+		if _, err := retired.ValidateToken(oldToken); err == nil {
+			t.Error("expected token to be rejected")
+		}
+	})
+	t.Run("should publish the public keys", func(t *testing.T) {
+		set := rotated.JWKS()
+		if len(set.Keys) != 2 {
+			t.Fatalf("expected 2 keys, got %d", len(set.Keys))
+		}
+		if set.Keys[0].Kty != "RSA" || set.Keys[1].Kty != "OKP" {
+			t.Errorf("unexpected key types %s %s", set.Keys[0].Kty, set.Keys[1].Kty)
+		}
+	})
+}
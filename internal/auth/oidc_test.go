@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubOIDCServer is a minimal provider which issues an id token for the code "good-code"
+// when the code verifier matches the challenge of the authorization request
+func stubOIDCServer(t *testing.T, challenge, nonce string) (*httptest.Server, *OIDCConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("could not generate rsa key: %v", err)
+	}
+	writeKey(t, dir, "stub", key)
+	signer, err := NewKeySetAuthenticator(dir, "", "", "")
+	if err != nil {
+		t.Fatalf("could not create signer: %v", err)
+	}
+
+	cfg := &OIDCConfig{ClientID: "client", RedirectURL: "http://localhost/callback"}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signer.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatalf("could not parse form: %v", err)
+		}
+		if r.PostForm.Get("code") != "good-code" || PKCEChallenge(r.PostForm.Get("code_verifier")) != challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		idToken, err := signer.GenerateToken(jwt.MapClaims{
+			"iss":            cfg.Issuer,
+			"aud":            cfg.ClientID,
+			"sub":            "provider-user-1",
+			"email":          "alice@example.com",
+			"email_verified": true,
+			"nonce":          nonce,
+			"exp":            time.Now().Add(time.Minute).Unix(),
+		})
+		if err != nil {
+			t.Fatalf("could not sign id token: %v", err)
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	cfg.Issuer = srv.URL
+	cfg.AuthURL = srv.URL + "/authorize"
+	cfg.TokenURL = srv.URL + "/token"
+	cfg.JWKSURL = srv.URL + "/jwks"
+	return srv, cfg
+}
+
+func TestOIDCProvider(t *testing.T) {
+	verifier, err := NewPKCEVerifier()
+	if err != nil {
+		t.Fatalf("could not create verifier: %v", err)
+	}
+	challenge := PKCEChallenge(verifier)
+	_, cfg := stubOIDCServer(t, challenge, "nonce-1")
+	provider := NewOIDCProvider(*cfg)
+
+	t.Run("should build the authorization url with pkce", func(t *testing.T) {
+		u, err := url.Parse(provider.AuthCodeURL("state-1", "nonce-1", challenge))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q := u.Query()
+		if q.Get("code_challenge") != challenge || q.Get("code_challenge_method") != "S256" {
+			t.Fatalf("missing pkce parameters in %s", u)
+		}
+		if q.Get("state") != "state-1" || q.Get("nonce") != "nonce-1" || q.Get("client_id") != "client" {
+			t.Fatalf("unexpected parameters in %s", u)
+		}
+	})
+
+	t.Run("should exchange the code for a verified identity", func(t *testing.T) {
+		identity, err := provider.Exchange(context.Background(), "good-code", verifier, "nonce-1")
+		if err != nil {
+			t.Fatalf("exchange failed: %v", err)
+		}
+		if identity.Subject != "provider-user-1" || identity.Email != "alice@example.com" || !identity.EmailVerified {
+			t.Fatalf("unexpected identity %+v", identity)
+		}
+	})
+
+	t.Run("should reject a wrong code verifier", func(t *testing.T) {
+		wrong, _ := NewPKCEVerifier()
+		if _, err := provider.Exchange(context.Background(), "good-code", wrong, "nonce-1"); err == nil {
+			t.Fatal("expected the exchange to fail")
+		}
+	})
+
+	t.Run("should reject a nonce mismatch", func(t *testing.T) {
+		_, err := provider.Exchange(context.Background(), "good-code", verifier, "other-nonce")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+
+	t.Run("should reject an id token for another client", func(t *testing.T) {
+		other := *cfg
+		other.ClientID = "other-client"
+		_, err := NewOIDCProvider(other).Exchange(context.Background(), "good-code", verifier, "nonce-1")
+		if !errors.Is(err, ErrInvalidIDToken) {
+			t.Fatalf("expected ErrInvalidIDToken, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B SHA1 seed, the reference codes are 8 digits so the last 6 are compared
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	t.Run("should match the rfc test vectors", func(t *testing.T) {
+		for _, v := range vectors {
+			code, err := TOTPCode(secret, TOTPStep(time.Unix(v.unix, 0)))
+			if err != nil {
+				t.Fatalf("could not compute code: %v", err)
+			}
+			if code != v.code {
+				t.Errorf("at %d expected %s, got %s", v.unix, v.code, code)
+			}
+		}
+	})
+	t.Run("should accept codes of the adjacent steps only", func(t *testing.T) {
+		now := time.Unix(1111111111, 0)
+		prev, _ := TOTPCode(secret, TOTPStep(now)-1)
+		if step, ok := ValidateTOTP(secret, prev, now); !ok || step != TOTPStep(now)-1 {
+			t.Errorf("expected previous step code to be accepted")
+		}
+		old, _ := TOTPCode(secret, TOTPStep(now)-3)
+		if _, ok := ValidateTOTP(secret, old, now); ok {
+			t.Errorf("expected old code to be rejected")
+		}
+	})
+	t.Run("should build a provisioning uri", func(t *testing.T) {
+		uri := TOTPProvisioningURI(secret, "GoSocial", "john")
+		if !strings.HasPrefix(uri, "otpauth://totp/GoSocial:john?") || !strings.Contains(uri, "secret="+secret) {
+			t.Errorf("unexpected uri %s", uri)
+		}
+	})
+}
@@ -3,9 +3,12 @@ package mailer
 import "embed"
 
 const (
-	FromName            = "GoSocial"
-	maxRetries          = 3
-	UserWelcomeTemplate = "user_invitation.tmpl"
+	FromName              = "GoSocial"
+	maxRetries            = 3
+	UserWelcomeTemplate   = "user_invitation.tmpl"
+	PasswordResetTemplate = "password_reset.tmpl"
+	EmailChangeTemplate   = "email_change.tmpl"
+	AccountLockedTemplate = "account_locked.tmpl"
 )
 
 //go:embed "templates"
@@ -0,0 +1,16 @@
+package mailer
+
+import "sync"
+
+// MockMailer records the emails it is asked to send instead of sending them
+type MockMailer struct {
+	sync.Mutex
+	Sent []string
+}
+
+func (m *MockMailer) Send(templateFile string, username string, email string, data any, isSandbox bool) error {
+	m.Lock()
+	defer m.Unlock()
+	m.Sent = append(m.Sent, email)
+	return nil
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// AuditEvent records who did what to which resource
+type AuditEvent struct {
+	ID         int64           `json:"id"`
+	ActorID    *int64          `json:"actor_id"`
+	Action     string          `json:"action"`
+	TargetType string          `json:"target_type"`
+	TargetID   *int64          `json:"target_id"`
+	IP         string          `json:"ip"`
+	RequestID  string          `json:"request_id"`
+	Diff       json.RawMessage `json:"diff" swaggertype:"object"`
+	CreatedAt  string          `json:"created_at"`
+}
+
+type AuditStore struct {
+	db *sql.DB
+}
+
+func (s *AuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	query := `INSERT INTO audit_events (actor_id, action, target_type, target_id, ip, request_id, diff)
+	VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	diff := event.Diff
+	if len(diff) == 0 {
+		diff = json.RawMessage(`{}`)
+	}
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		event.ActorID,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		event.IP,
+		event.RequestID,
+		[]byte(diff),
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+// List returns the events matching the query, newest first
+func (s *AuditStore) List(ctx context.Context, q PaginatedAuditQuery) ([]AuditEvent, error) {
+	query := `SELECT id, actor_id, action, target_type, target_id, ip, request_id, diff, created_at
+	FROM audit_events
+	WHERE
+		($1::BIGINT IS NULL OR actor_id = $1) AND
+		($2 = '' OR action = $2) AND
+		($3 = '' OR target_type = $3) AND
+		($4::BIGINT IS NULL OR target_id = $4) AND
+		($5::TIMESTAMPTZ IS NULL OR created_at >= $5) AND
+		($6::TIMESTAMPTZ IS NULL OR created_at <= $6)
+	ORDER BY id DESC
+	LIMIT $7 OFFSET $8`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		query,
+		q.ActorID,
+		q.Action,
+		q.TargetType,
+		q.TargetID,
+		q.From,
+		q.To,
+		q.Limit,
+		q.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []AuditEvent{}
+	for rows.Next() {
+		var e AuditEvent
+		var diff []byte
+		err := rows.Scan(
+			&e.ID,
+			&e.ActorID,
+			&e.Action,
+			&e.TargetType,
+			&e.TargetID,
+			&e.IP,
+			&e.RequestID,
+			&diff,
+			&e.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		e.Diff = diff
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
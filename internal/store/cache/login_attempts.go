@@ -0,0 +1,176 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// lockoutsTTL is how long previous lockouts count towards the next lockout duration
+const lockoutsTTL = time.Hour * 24
+
+// LoginAttemptStore tracks failed logins and lockouts per key (an account or an ip) in redis
+type LoginAttemptStore struct {
+	rdb *redis.Client
+}
+
+func (s *LoginAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	cacheKey := fmt.Sprintf("login-failures:%s", key)
+	count, err := s.rdb.Incr(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	if count == 1 {
+		if err := s.rdb.Expire(ctx, cacheKey, window).Err(); err != nil {
+			return 0, err
+		}
+	}
+	return count, nil
+}
+
+func (s *LoginAttemptStore) Reset(ctx context.Context, key string) error {
+	cacheKey := fmt.Sprintf("login-failures:%s", key)
+	return s.rdb.Del(ctx, cacheKey).Err()
+}
+
+func (s *LoginAttemptStore) IncrLockouts(ctx context.Context, key string) (int64, error) {
+	cacheKey := fmt.Sprintf("login-lockouts:%s", key)
+	count, err := s.rdb.Incr(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	if err := s.rdb.Expire(ctx, cacheKey, lockoutsTTL).Err(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *LoginAttemptStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	cacheKey := fmt.Sprintf("login-lock:%s", key)
+	return s.rdb.SetEX(ctx, cacheKey, 1, d).Err()
+}
+
+func (s *LoginAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	cacheKey := fmt.Sprintf("login-lock:%s", key)
+	ttl, err := s.rdb.PTTL(ctx, cacheKey).Result()
+	if err != nil {
+		return 0, err
+	}
+	// negative ttl means the key does not exist (or has no expiry)
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// Unlock clears the lock, the lockout history and the failures of the key
+func (s *LoginAttemptStore) Unlock(ctx context.Context, key string) error {
+	return s.rdb.Del(
+		ctx,
+		fmt.Sprintf("login-lock:%s", key),
+		fmt.Sprintf("login-lockouts:%s", key),
+		fmt.Sprintf("login-failures:%s", key),
+	).Err()
+}
+
+// MemoryLoginAttemptStore is the in process login attempt tracking used when redis is disabled
+type MemoryLoginAttemptStore struct {
+	mu       sync.Mutex
+	failures map[string]*counter
+	lockouts map[string]*counter
+	locks    map[string]time.Time
+}
+
+type counter struct {
+	count int64
+	exp   time.Time
+}
+
+func NewMemoryLoginAttemptStore() *MemoryLoginAttemptStore {
+	return &MemoryLoginAttemptStore{
+		failures: make(map[string]*counter),
+		lockouts: make(map[string]*counter),
+		locks:    make(map[string]time.Time),
+	}
+}
+
+func (s *MemoryLoginAttemptStore) Fail(ctx context.Context, key string, window time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return incr(s.failures, key, window, false), nil
+}
+
+func (s *MemoryLoginAttemptStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.failures, key)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) IncrLockouts(ctx context.Context, key string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return incr(s.lockouts, key, lockoutsTTL, true), nil
+}
+
+func (s *MemoryLoginAttemptStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	// drop the locks which has already expired
+	for k, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, k)
+		}
+	}
+	s.locks[key] = now.Add(d)
+	return nil
+}
+
+func (s *MemoryLoginAttemptStore) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	d := time.Until(until)
+	if d <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return d, nil
+}
+
+func (s *MemoryLoginAttemptStore) Unlock(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.locks, key)
+	delete(s.lockouts, key)
+	delete(s.failures, key)
+	return nil
+}
+
+// incr increments the counter of key, expired counters start over.
+// When extend is set every increment pushes the expiry out again
+func incr(counters map[string]*counter, key string, ttl time.Duration, extend bool) int64 {
+	now := time.Now()
+	for k, c := range counters {
+		if now.After(c.exp) {
+			delete(counters, k)
+		}
+	}
+	c, ok := counters[key]
+	if !ok || now.After(c.exp) {
+		c = &counter{exp: now.Add(ttl)}
+		counters[key] = c
+	}
+	if extend {
+		c.exp = now.Add(ttl)
+	}
+	c.count++
+	return c.count
+}
@@ -2,13 +2,21 @@ package cache
 
 import (
 	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
 )
 
 func NewMockCache() Storage {
 	return Storage{
-		Users: &MockUserStore{},
+		Users:         &MockUserStore{},
+		Tokens:        NewMemoryTokenStore(),
+		LoginAttempts: NewMemoryLoginAttemptStore(),
+		OAuthStates:   NewMemoryOAuthStateStore(),
+		Timelines:     NewMockTimelineStore(),
 	}
 }
 
@@ -24,3 +32,80 @@ func (m *MockUserStore) Set(ctx context.Context, u *store.User) error {
 
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 }
+
+// MockTimelineStore keeps the timelines in memory, they do not expire
+type MockTimelineStore struct {
+	sync.Mutex
+	timelines map[int64]mockTimeline
+}
+
+type mockTimeline struct {
+	entries      []store.TimelineEntry
+	celebrityIDs []int64
+}
+
+func NewMockTimelineStore() *MockTimelineStore {
+	return &MockTimelineStore{timelines: make(map[int64]mockTimeline)}
+}
+
+func (m *MockTimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry, size int) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, id := range userIDs {
+		timeline, ok := m.timelines[id]
+		if !ok {
+			continue
+		}
+		entries := append([]store.TimelineEntry{entry}, timeline.entries...)
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		})
+		timeline.entries = entries[:min(len(entries), size)]
+		m.timelines[id] = timeline
+	}
+	return nil
+}
+
+func (m *MockTimelineStore) Remove(ctx context.Context, userIDs []int64, postID int64, size int) error {
+	m.Lock()
+	defer m.Unlock()
+	for _, id := range userIDs {
+		timeline := m.timelines[id]
+		i := slices.IndexFunc(timeline.entries, func(e store.TimelineEntry) bool { return e.PostID == postID })
+		if i < 0 {
+			continue
+		}
+		// like in redis, full timelines and timelines left without posts are dropped
+		if len(timeline.entries) >= size || len(timeline.entries) == 1 {
+			delete(m.timelines, id)
+			continue
+		}
+		timeline.entries = slices.Delete(slices.Clone(timeline.entries), i, i+1)
+		m.timelines[id] = timeline
+	}
+	return nil
+}
+
+func (m *MockTimelineStore) Replace(ctx context.Context, userID int64, entries []store.TimelineEntry, celebrityIDs []int64, ttl time.Duration) error {
+	m.Lock()
+	defer m.Unlock()
+	m.timelines[userID] = mockTimeline{entries: entries, celebrityIDs: celebrityIDs}
+	return nil
+}
+
+func (m *MockTimelineStore) Range(ctx context.Context, userID int64, count int) ([]store.TimelineEntry, []int64, bool, error) {
+	m.Lock()
+	defer m.Unlock()
+	timeline, ok := m.timelines[userID]
+	if !ok {
+		return nil, nil, false, nil
+	}
+	return timeline.entries[:min(len(timeline.entries), count)], timeline.celebrityIDs, true, nil
+}
+
+func (m *MockTimelineStore) Delete(ctx context.Context, userID int64) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.timelines, userID)
+	return nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// OAuthStateStore keeps the pending authorization requests of external logins in redis,
+// keyed by the state parameter sent to the provider
+type OAuthStateStore struct {
+	rdb *redis.Client
+}
+
+func (s *OAuthStateStore) Save(ctx context.Context, state string, value string, ttl time.Duration) error {
+	cacheKey := fmt.Sprintf("oauth-state:%s", state)
+	return s.rdb.SetEX(ctx, cacheKey, value, ttl).Err()
+}
+
+// Pop returns the value saved for state and deletes it, so a state can only be used once.
+// It returns an empty value when the state is unknown or expired
+func (s *OAuthStateStore) Pop(ctx context.Context, state string) (string, error) {
+	cacheKey := fmt.Sprintf("oauth-state:%s", state)
+	value, err := s.rdb.GetDel(ctx, cacheKey).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return value, err
+}
+
+// MemoryOAuthStateStore is the in process state store used when redis is disabled
+type MemoryOAuthStateStore struct {
+	mu     sync.Mutex
+	states map[string]oauthState
+}
+
+type oauthState struct {
+	value string
+	exp   time.Time
+}
+
+func NewMemoryOAuthStateStore() *MemoryOAuthStateStore {
+	return &MemoryOAuthStateStore{
+		states: make(map[string]oauthState),
+	}
+}
+
+func (s *MemoryOAuthStateStore) Save(ctx context.Context, state string, value string, ttl time.Duration) error {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// drop the states which has already expired
+	for k, st := range s.states {
+		if now.After(st.exp) {
+			delete(s.states, k)
+		}
+	}
+	s.states[state] = oauthState{value: value, exp: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryOAuthStateStore) Pop(ctx context.Context, state string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st, ok := s.states[state]
+	if !ok {
+		return "", nil
+	}
+	delete(s.states, state)
+	if time.Now().After(st.exp) {
+		return "", nil
+	}
+	return st.value, nil
+}
@@ -2,6 +2,7 @@ package cache
 
 import (
 	"context"
+	"time"
 
 	"github.com/Shadowcyng/goSocial/internal/store"
 	"github.com/go-redis/redis/v8"
@@ -13,10 +14,39 @@ type Storage struct {
 		Set(context.Context, *store.User) error
 		Delete(context.Context, int64)
 	}
+	Tokens interface {
+		Revoke(context.Context, string, time.Duration) error
+		IsRevoked(context.Context, string) (bool, error)
+		RevokeUser(context.Context, int64, time.Duration) error
+		UserRevokedAt(context.Context, int64) (time.Time, error)
+	}
+	LoginAttempts interface {
+		Fail(context.Context, string, time.Duration) (int64, error)
+		Reset(context.Context, string) error
+		IncrLockouts(context.Context, string) (int64, error)
+		Lock(context.Context, string, time.Duration) error
+		LockedFor(context.Context, string) (time.Duration, error)
+		Unlock(context.Context, string) error
+	}
+	OAuthStates interface {
+		Save(context.Context, string, string, time.Duration) error
+		Pop(context.Context, string) (string, error)
+	}
+	Timelines interface {
+		Push(context.Context, []int64, store.TimelineEntry, int) error
+		Remove(context.Context, []int64, int64, int) error
+		Replace(context.Context, int64, []store.TimelineEntry, []int64, time.Duration) error
+		Range(context.Context, int64, int) ([]store.TimelineEntry, []int64, bool, error)
+		Delete(context.Context, int64) error
+	}
 }
 
 func NewRedisStorage(rdb *redis.Client) Storage {
 	return Storage{
-		Users: &UserStore{rdb: rdb},
+		Users:         &UserStore{rdb: rdb},
+		Tokens:        &TokenStore{rdb: rdb},
+		LoginAttempts: &LoginAttemptStore{rdb: rdb},
+		OAuthStates:   &OAuthStateStore{rdb: rdb},
+		Timelines:     &TimelineStore{rdb: rdb},
 	}
 }
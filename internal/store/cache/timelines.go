@@ -0,0 +1,162 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/go-redis/redis/v8"
+)
+
+// TimelineStore keeps the home timeline of every user as a sorted set of post ids scored by
+// the creation time of the post, capped to the latest posts. Next to it are the ids of the
+// celebrities the user follows, whose posts are not pushed but merged when the timeline is read
+type TimelineStore struct {
+	rdb *redis.Client
+}
+
+// emptyTimeline marks a built timeline without posts, so it is not rebuilt on every read
+const emptyTimeline = "0"
+
+// pushTimeline adds a post to a timeline which has been built, timelines which are not built
+// (or have expired) are left to be rebuilt from the database on their next read
+var pushTimeline = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("ZADD", KEYS[1], ARGV[1], ARGV[2])
+redis.call("ZREM", KEYS[1], "` + emptyTimeline + `")
+redis.call("ZREMRANGEBYRANK", KEYS[1], 0, -tonumber(ARGV[3]) - 1)
+return 1
+`)
+
+// removeFromTimeline drops a post from a timeline. A full timeline is dropped instead, the next
+// older post which takes the place of the removed one is not in it. A timeline left without
+// posts is gone as well and rebuilt on its next read
+var removeFromTimeline = redis.NewScript(`
+if redis.call("ZSCORE", KEYS[1], ARGV[1]) == false then
+	return 0
+end
+if redis.call("ZCARD", KEYS[1]) >= tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1])
+	return 1
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+return 1
+`)
+
+func timelineKey(userID int64) string {
+	return fmt.Sprintf("timeline:%d", userID)
+}
+
+func celebritiesKey(userID int64) string {
+	return fmt.Sprintf("timeline-celebrities:%d", userID)
+}
+
+// Push adds the post to the timelines of the users keeping at most size posts in each
+func (s *TimelineStore) Push(ctx context.Context, userIDs []int64, entry store.TimelineEntry, size int) error {
+	pipe := s.rdb.Pipeline()
+	for _, id := range userIDs {
+		pushTimeline.Eval(ctx, pipe, []string{timelineKey(id)}, entry.CreatedAt.UnixMilli(), entry.PostID, size)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Remove drops the post from the timelines of the users holding at most size posts
+func (s *TimelineStore) Remove(ctx context.Context, userIDs []int64, postID int64, size int) error {
+	pipe := s.rdb.Pipeline()
+	for _, id := range userIDs {
+		removeFromTimeline.Eval(ctx, pipe, []string{timelineKey(id)}, postID, size)
+	}
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Replace swaps the timeline of the user for entries and the celebrities the user follows, both
+// expire after ttl
+func (s *TimelineStore) Replace(ctx context.Context, userID int64, entries []store.TimelineEntry, celebrityIDs []int64, ttl time.Duration) error {
+	key := timelineKey(userID)
+	members := make([]*redis.Z, 0, len(entries)+1)
+	for _, e := range entries {
+		members = append(members, &redis.Z{Score: float64(e.CreatedAt.UnixMilli()), Member: e.PostID})
+	}
+	if len(members) == 0 {
+		members = append(members, &redis.Z{Score: 0, Member: emptyTimeline})
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.Expire(ctx, key, ttl)
+	pipe.Set(ctx, celebritiesKey(userID), formatIDs(celebrityIDs), ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Range returns the latest count posts of the timeline of the user, newest first, with the
+// celebrities the user follows. It reports false when the timeline has not been built
+func (s *TimelineStore) Range(ctx context.Context, userID int64, count int) ([]store.TimelineEntry, []int64, bool, error) {
+	key := timelineKey(userID)
+	pipe := s.rdb.Pipeline()
+	exists := pipe.Exists(ctx, key)
+	members := pipe.ZRevRangeWithScores(ctx, key, 0, int64(count-1))
+	celebrities := pipe.Get(ctx, celebritiesKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, nil, false, err
+	}
+	if exists.Val() == 0 || celebrities.Err() == redis.Nil {
+		return nil, nil, false, nil
+	}
+	celebrityIDs, err := parseIDs(celebrities.Val())
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	entries := make([]store.TimelineEntry, 0, len(members.Val()))
+	for _, z := range members.Val() {
+		member, _ := z.Member.(string)
+		if member == emptyTimeline {
+			continue
+		}
+		id, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		entries = append(entries, store.TimelineEntry{PostID: id, CreatedAt: time.UnixMilli(int64(z.Score))})
+	}
+	return entries, celebrityIDs, true, nil
+}
+
+// Delete drops the timeline of the user, it is rebuilt on its next read
+func (s *TimelineStore) Delete(ctx context.Context, userID int64) error {
+	return s.rdb.Del(ctx, timelineKey(userID), celebritiesKey(userID)).Err()
+}
+
+// formatIDs joins the ids with commas, parseIDs splits them back
+func formatIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseIDs(s string) ([]int64, error) {
+	if s == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	ids := make([]int64, len(parts))
+	for i, part := range parts {
+		id, err := strconv.ParseInt(part, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// TokenStore keeps the denylist of revoked access tokens (by jti) in redis
+type TokenStore struct {
+	rdb *redis.Client
+}
+
+func (s *TokenStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	cacheKey := fmt.Sprintf("revoked-token:%s", jti)
+	return s.rdb.SetEX(ctx, cacheKey, 1, ttl).Err()
+}
+
+func (s *TokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	cacheKey := fmt.Sprintf("revoked-token:%s", jti)
+	n, err := s.rdb.Exists(ctx, cacheKey).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// RevokeUser invalidates every token issued to the user before now, to the millisecond so the
+// tokens issued right after are still valid
+func (s *TokenStore) RevokeUser(ctx context.Context, userID int64, ttl time.Duration) error {
+	cacheKey := fmt.Sprintf("revoked-user:%d", userID)
+	return s.rdb.SetEX(ctx, cacheKey, time.Now().UnixMilli(), ttl).Err()
+}
+
+func (s *TokenStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	cacheKey := fmt.Sprintf("revoked-user:%d", userID)
+	at, err := s.rdb.Get(ctx, cacheKey).Int64()
+	if err == redis.Nil {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(at), nil
+}
+
+// MemoryTokenStore is the in process denylist used when redis is disabled
+type MemoryTokenStore struct {
+	sync.RWMutex
+	revoked      map[string]time.Time
+	revokedUsers map[int64]userRevocation
+}
+
+type userRevocation struct {
+	at  time.Time
+	exp time.Time
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		revoked:      make(map[string]time.Time),
+		revokedUsers: make(map[int64]userRevocation),
+	}
+}
+
+func (s *MemoryTokenStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	if ttl <= 0 {
+		return nil
+	}
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	// drop the entries which has already expired
+	for k, exp := range s.revoked {
+		if now.After(exp) {
+			delete(s.revoked, k)
+		}
+	}
+	s.revoked[jti] = now.Add(ttl)
+	return nil
+}
+
+func (s *MemoryTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	s.RLock()
+	exp, ok := s.revoked[jti]
+	s.RUnlock()
+	return ok && time.Now().Before(exp), nil
+}
+
+func (s *MemoryTokenStore) RevokeUser(ctx context.Context, userID int64, ttl time.Duration) error {
+	now := time.Now()
+	s.Lock()
+	defer s.Unlock()
+	for k, revocation := range s.revokedUsers {
+		if now.After(revocation.exp) {
+			delete(s.revokedUsers, k)
+		}
+	}
+	// tokens can not outlive ttl, so an older revocation can simply be overwritten
+	s.revokedUsers[userID] = userRevocation{at: now.Truncate(time.Millisecond), exp: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryTokenStore) UserRevokedAt(ctx context.Context, userID int64) (time.Time, error) {
+	s.Lock()
+	defer s.Unlock()
+	revocation, ok := s.revokedUsers[userID]
+	if !ok {
+		return time.Time{}, nil
+	}
+	if time.Now().After(revocation.exp) {
+		delete(s.revokedUsers, userID)
+		return time.Time{}, nil
+	}
+	return revocation.at, nil
+}
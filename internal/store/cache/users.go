@@ -48,6 +48,6 @@ func (s *UserStore) Set(ctx context.Context, user *store.User) error {
 
 }
 func (s *UserStore) Delete(ctx context.Context, userID int64) {
-	cacheKey := fmt.Sprintf("user-%d", userID)
+	cacheKey := fmt.Sprintf("user:%d", userID)
 	s.rdb.Del(ctx, cacheKey)
 }
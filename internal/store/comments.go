@@ -3,8 +3,16 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+// RemovedCommentContent replaces the content of removed comments
+const RemovedCommentContent = "[removed]"
+
 type Comment struct {
 	ID        int64  `json:"id"`
 	PostID    int64  `json:"post_id"`
@@ -12,29 +20,190 @@ type Comment struct {
 	Content   string `json:"content"`
 	CreatedAt string `json:"created_at"`
 	User      User   `json:"user"`
+	// ParentID is the comment replied to, nil for top level comments which have depth 0
+	ParentID *int64 `json:"parent_id"`
+	Depth    int    `json:"depth"`
+	// EditedAt is set once the content is changed, RemovedAt when the comment is removed
+	EditedAt  *time.Time `json:"edited_at"`
+	RemovedAt *time.Time `json:"removed_at,omitempty"`
+	// ReplyCount is the number of direct replies, only set on listed top level comments
+	ReplyCount int `json:"reply_count"`
+	// RepliesCursor gets the replies left out of the thread of a listed top level comment from
+	// the replies endpoint, empty when the whole thread is loaded
+	RepliesCursor string `json:"replies_cursor,omitempty"`
+	// Replies is only filled when the comments are returned as a tree
+	Replies []Comment `json:"replies,omitempty"`
 }
 
 type CommentStore struct {
 	db *sql.DB
 }
 
-func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
-	query := `SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, u.username, u.id  FROM comments c
-	JOIN users u on u.id = c.user_id
-	WHERE post_id = $1
-	ORDER BY c.created_at DESC;
+type commentCursor struct {
+	ID      int64 `json:"id"`
+	Replies int   `json:"replies,omitempty"`
+}
+
+// replyCursor is the path of ids from the first reply of the thread down to the last reply read
+type replyCursor struct {
+	Path []int64 `json:"path"`
+}
+
+// keyset condition and order of every comment sort, $2 and $3 are the id and reply count of the cursor
+var commentSorts = map[string]struct{ after, order string }{
+	"newest": {"id < $2", "id DESC"},
+	"oldest": {"id > $2", "id ASC"},
+	"top":    {"(reply_count, id) < ($3, $2)", "reply_count DESC, id DESC"},
+}
+
+// List returns a page of the top level comments of the post with the cursor of the next page,
+// the cursor is empty on the last page
+func (s *CommentStore) List(ctx context.Context, postID int64, q PaginatedCommentQuery) ([]Comment, string, error) {
+	var cursor *commentCursor
+	if q.Cursor != "" {
+		cursor = &commentCursor{}
+		if err := decodeCursor(q.Cursor, cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	sort, ok := commentSorts[q.Sort]
+	if !ok {
+		sort = commentSorts["newest"]
+	}
+
+	query := fmt.Sprintf(`SELECT id, post_id, user_id, content, created_at, parent_id, depth, edited_at, removed_at, username, reply_count
+	FROM (
+		SELECT c.*, COALESCE(u.username, '') AS username, (SELECT COUNT(*) FROM comments r WHERE r.parent_id = c.id) AS reply_count
+		FROM comments c
+		LEFT JOIN users u on u.id = c.user_id
+		WHERE c.post_id = $1 AND c.parent_id IS NULL
+	) c
+	WHERE $2::BIGINT IS NULL OR %s
+	ORDER BY %s
+	LIMIT $4;
+	`, sort.after, sort.order)
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var cursorID *int64
+	var cursorReplies int
+	if cursor != nil {
+		cursorID = &cursor.ID
+		cursorReplies = cursor.Replies
+	}
+	// one more row than the limit tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, query, postID, cursorID, cursorReplies, q.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	comments := []Comment{}
+	for rows.Next() {
+		var c Comment
+		err := rows.Scan(
+			&c.ID,
+			&c.PostID,
+			&c.UserID,
+			&c.Content,
+			&c.CreatedAt,
+			&c.ParentID,
+			&c.Depth,
+			&c.EditedAt,
+			&c.RemovedAt,
+			&c.User.Username,
+			&c.ReplyCount,
+		)
+		if err != nil {
+			return nil, "", err
+		}
+		c.User.ID = c.UserID
+		comments = append(comments, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(comments) <= q.Limit {
+		return comments, "", nil
+	}
+	comments = comments[:q.Limit]
+	last := comments[len(comments)-1]
+	next, err := encodeCursor(commentCursor{ID: last.ID, Replies: last.ReplyCount})
+	if err != nil {
+		return nil, "", err
+	}
+	return comments, next, nil
+}
+
+// GetReplies returns the first limit replies below each of the comments in thread order, the
+// replies to a comment oldest first. The threads with more replies get the cursor of the rest,
+// by the id of their comment
+func (s *CommentStore) GetReplies(ctx context.Context, commentIDs []int64, limit int) ([]Comment, map[int64]string, error) {
+	return s.getReplies(ctx, commentIDs, nil, limit)
+}
+
+// GetThreadReplies returns a page of the replies below the comment in thread order, with the
+// cursor of the next page which is empty on the last page
+func (s *CommentStore) GetThreadReplies(ctx context.Context, commentID int64, q PaginatedReplyQuery) ([]Comment, string, error) {
+	var after []int64
+	if q.Cursor != "" {
+		var cursor replyCursor
+		if err := decodeCursor(q.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+		after = cursor.Path
+	}
+	replies, cursors, err := s.getReplies(ctx, []int64{commentID}, after, q.Limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return replies, cursors[commentID], nil
+}
+
+// getReplies returns up to limit replies of the threads below the comments, after the path when
+// one is given
+func (s *CommentStore) getReplies(ctx context.Context, commentIDs []int64, after []int64, limit int) ([]Comment, map[int64]string, error) {
+	query := `WITH RECURSIVE thread AS (
+		SELECT id, parent_id AS root, ARRAY[id] AS path
+		FROM comments
+		WHERE parent_id = ANY($1)
+		UNION ALL
+		SELECT c.id, t.root, t.path || c.id
+		FROM comments c
+		JOIN thread t ON c.parent_id = t.id
+	), page AS (
+		SELECT id, root, path, ROW_NUMBER() OVER (PARTITION BY root ORDER BY path) AS n
+		FROM thread
+		WHERE $2::BIGINT[] IS NULL OR path > $2
+	)
+	SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, c.parent_id, c.depth, c.edited_at, c.removed_at, COALESCE(u.username, ''), c.user_id, p.root, p.path
+	FROM page p
+	JOIN comments c ON c.id = p.id
+	LEFT JOIN users u on u.id = c.user_id
+	WHERE p.n <= $3
+	ORDER BY p.path;
 	`
 
 	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
 	defer cancelCtx()
 
-	rows, err := s.db.QueryContext(ctx, query, postID)
+	// one more reply than the limit tells whether the thread has more
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(commentIDs), pq.Array(after), limit+1)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	defer rows.Close()
+
 	comments := []Comment{}
+	counts := make(map[int64]int)
+	lastPaths := make(map[int64][]int64)
+	cursors := make(map[int64]string)
 	for rows.Next() {
 		var c Comment
+		var root int64
+		var path []int64
 		c.User = User{}
 		err := rows.Scan(
 			&c.ID,
@@ -42,28 +211,198 @@ func (s *CommentStore) GetByPostID(ctx context.Context, postID int64) ([]Comment
 			&c.UserID,
 			&c.Content,
 			&c.CreatedAt,
+			&c.ParentID,
+			&c.Depth,
+			&c.EditedAt,
+			&c.RemovedAt,
 			&c.User.Username,
 			&c.User.ID,
+			&root,
+			pq.Array(&path),
 		)
 		if err != nil {
-			return nil, err
+			return nil, nil, err
+		}
+		counts[root]++
+		if counts[root] > limit {
+			cursor, err := encodeCursor(replyCursor{Path: lastPaths[root]})
+			if err != nil {
+				return nil, nil, err
+			}
+			cursors[root] = cursor
+			continue
 		}
+		lastPaths[root] = path
 		comments = append(comments, c)
 	}
-	return comments, nil
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	return comments, cursors, nil
+}
+
+// CountByPostID counts the comments of the post, replies and removed comments included
+func (s *CommentStore) CountByPostID(ctx context.Context, postID int64) (int, error) {
+	query := `SELECT COUNT(*) FROM comments WHERE post_id = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, query, postID).Scan(&count); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (s *CommentStore) GetById(ctx context.Context, commentID int64) (*Comment, error) {
+	query := `SELECT id, post_id, user_id, content, created_at, parent_id, depth, edited_at, removed_at
+	FROM comments
+	WHERE id = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var c Comment
+	err := s.db.QueryRowContext(ctx, query, commentID).Scan(
+		&c.ID,
+		&c.PostID,
+		&c.UserID,
+		&c.Content,
+		&c.CreatedAt,
+		&c.ParentID,
+		&c.Depth,
+		&c.EditedAt,
+		&c.RemovedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &c, nil
 }
 
 func (s *CommentStore) Create(ctx context.Context, comment *Comment) error {
-	query := `INSERT INTO comments(post_id, user_id, content) 
-	VALUES ($1, $2, $3) RETURNING id, created_at;
+	query := `INSERT INTO comments(post_id, user_id, content, parent_id, depth) 
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at;
 	`
 
 	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
 	defer cancelCtx()
 
-	err := s.db.QueryRowContext(ctx, query, comment.PostID, comment.UserID, comment.Content).Scan(&comment.ID, &comment.CreatedAt)
+	err := s.db.QueryRowContext(
+		ctx,
+		query,
+		comment.PostID,
+		comment.UserID,
+		comment.Content,
+		comment.ParentID,
+		comment.Depth,
+	).Scan(&comment.ID, &comment.CreatedAt)
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// Update changes the content of a comment which has not been removed
+func (s *CommentStore) Update(ctx context.Context, comment *Comment) error {
+	query := `UPDATE comments SET content = $1, edited_at = NOW()
+	WHERE id = $2 AND removed_at IS NULL
+	RETURNING edited_at`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	err := s.db.QueryRowContext(ctx, query, comment.Content, comment.ID).Scan(&comment.EditedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrorNotFound
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete deletes a comment without replies, a comment with replies is removed instead
+func (s *CommentStore) Delete(ctx context.Context, commentID int64) error {
+	query := `DELETE FROM comments c
+	WHERE id = $1 AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, commentID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return s.Remove(ctx, commentID)
+	}
+	return nil
+}
+
+// Remove replaces the comment with a tombstone, its replies and the comment counts stay as they are
+func (s *CommentStore) Remove(ctx context.Context, commentID int64) error {
+	query := `UPDATE comments SET content = $1, removed_at = NOW()
+	WHERE id = $2 AND removed_at IS NULL`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, RemovedCommentContent, commentID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// NestReplies puts the replies, as returned by GetReplies, under the comments they reply to
+func NestReplies(comments, replies []Comment) []Comment {
+	children := make(map[int64][]Comment)
+	for _, c := range replies {
+		children[*c.ParentID] = append(children[*c.ParentID], c)
+	}
+
+	var nest func([]Comment) []Comment
+	nest = func(level []Comment) []Comment {
+		for i := range level {
+			level[i].Replies = nest(children[level[i].ID])
+		}
+		return level
+	}
+	return nest(comments)
+}
+
+// FlattenThreads lists every comment followed by its replies, their depth tells how they nest
+func FlattenThreads(comments, replies []Comment) []Comment {
+	flat := make([]Comment, 0, len(comments)+len(replies))
+	var walk func([]Comment)
+	walk = func(level []Comment) {
+		for _, c := range level {
+			replies := c.Replies
+			c.Replies = nil
+			flat = append(flat, c)
+			walk(replies)
+		}
+	}
+	walk(NestReplies(comments, replies))
+	return flat
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCursor(t *testing.T) {
+	t.Run("should decode the cursors it encoded", func(t *testing.T) {
+		cursor, err := encodeCursor(searchCursor{Rank: 0.25, ID: 42})
+		if err != nil {
+			t.Fatalf("could not encode cursor: %v", err)
+		}
+		var search searchCursor
+		if err := decodeCursor(cursor, &search); err != nil {
+			t.Fatalf("could not decode cursor: %v", err)
+		}
+		if search.Rank != 0.25 || search.ID != 42 {
+			t.Errorf("unexpected search cursor %+v", search)
+		}
+
+		cursor, err = encodeCursor(replyCursor{Path: []int64{3, 7, 9}})
+		if err != nil {
+			t.Fatalf("could not encode cursor: %v", err)
+		}
+		var reply replyCursor
+		if err := decodeCursor(cursor, &reply); err != nil {
+			t.Fatalf("could not decode cursor: %v", err)
+		}
+		if !slices.Equal(reply.Path, []int64{3, 7, 9}) {
+			t.Errorf("unexpected reply cursor %+v", reply)
+		}
+	})
+
+	cases := map[string]string{
+		"bad base64": "not base64!",
+		"bad json":   base64.RawURLEncoding.EncodeToString([]byte(`{"rank": 0.25,`)),
+		"wrong type": base64.RawURLEncoding.EncodeToString([]byte(`{"rank": "high", "id": 42}`)),
+	}
+	for name, cursor := range cases {
+		t.Run("should reject a cursor with "+name, func(t *testing.T) {
+			var search searchCursor
+			if err := decodeCursor(cursor, &search); !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("expected ErrInvalidCursor, got %v", err)
+			}
+		})
+	}
+}
@@ -45,3 +45,60 @@ func (s *FollowerStore) Unfollow(ctx context.Context, followerId int64, userId i
 	}
 	return nil
 }
+
+// FollowedUser is a user someone follows, with the number of followers of that user
+type FollowedUser struct {
+	ID        int64 `json:"id"`
+	Followers int   `json:"followers"`
+}
+
+// GetFollowerIDs returns up to limit users following the user, a followers row with user_id A
+// and follower_id B means A follows B
+func (s *FollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	query := `SELECT user_id FROM followers WHERE follower_id = $1 LIMIT $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetFollowing returns the users the user follows with their follower counts
+func (s *FollowerStore) GetFollowing(ctx context.Context, userID int64) ([]FollowedUser, error) {
+	query := `SELECT f.follower_id, (SELECT COUNT(*) FROM followers c WHERE c.follower_id = f.follower_id)
+	FROM followers f
+	WHERE f.user_id = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	following := []FollowedUser{}
+	for rows.Next() {
+		var u FollowedUser
+		if err := rows.Scan(&u.ID, &u.Followers); err != nil {
+			return nil, err
+		}
+		following = append(following, u)
+	}
+	return following, rows.Err()
+}
@@ -0,0 +1,98 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// UserIdentity links a user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	ID        int64  `json:"id"`
+	UserID    int64  `json:"user_id"`
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"created_at"`
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+func (s *IdentityStore) GetBySubject(ctx context.Context, provider string, subject string) (*UserIdentity, error) {
+	query := `SELECT id, user_id, provider, subject, email, created_at
+	FROM user_identities
+	WHERE provider = $1 AND subject = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var identity UserIdentity
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Provider,
+		&identity.Subject,
+		&identity.Email,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &identity, nil
+}
+
+// Create links the identity to an existing user
+func (s *IdentityStore) Create(ctx context.Context, identity *UserIdentity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, identity)
+	})
+}
+
+// CreateUser registers a new active user for the identity, the provider has already verified the email
+func (s *IdentityStore) CreateUser(ctx context.Context, user *User, identity *UserIdentity) error {
+	users := &UserStore{db: s.db}
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := users.Create(ctx, tx, user); err != nil {
+			return err
+		}
+		user.IsActive = true
+		if err := users.update(ctx, tx, user); err != nil {
+			return err
+		}
+		identity.UserID = user.ID
+		return s.create(ctx, tx, identity)
+	})
+}
+
+func (s *IdentityStore) create(ctx context.Context, tx *sql.Tx, identity *UserIdentity) error {
+	query := `INSERT INTO user_identities (user_id, provider, subject, email)
+	VALUES ($1, $2, $3, $4) RETURNING id, created_at`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		identity.UserID,
+		identity.Provider,
+		identity.Subject,
+		identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
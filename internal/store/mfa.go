@@ -0,0 +1,129 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+)
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+// SetTOTPSecret starts (or restarts) enrollment, the secret is not enforced until EnableTOTP
+func (s *MFAStore) SetTOTPSecret(ctx context.Context, userID int64, secret string) error {
+	query := `UPDATE users SET totp_secret = $1, totp_enabled = false, totp_last_step = NULL WHERE id = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// EnableTOTP turns two factor authentication on and replaces the recovery codes of the user
+func (s *MFAStore) EnableTOTP(ctx context.Context, userID int64, recoveryCodeHashes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET totp_enabled = true WHERE id = $1 AND totp_secret IS NOT NULL`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorNotFound
+		}
+		return s.replaceRecoveryCodes(ctx, tx, userID, recoveryCodeHashes)
+	})
+}
+
+func (s *MFAStore) DisableTOTP(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET totp_secret = NULL, totp_enabled = false, totp_last_step = NULL WHERE id = $1`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+		return s.replaceRecoveryCodes(ctx, tx, userID, nil)
+	})
+}
+
+// UseTOTPStep records the time step of an accepted code, it returns false
+// when the step (or a later one) was already used
+func (s *MFAStore) UseTOTPStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := `UPDATE users SET totp_last_step = $1
+	WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+// UseRecoveryCode consumes an unused recovery code, it returns false when there is none
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, codeHash string) (bool, error) {
+	query := `UPDATE mfa_recovery_codes SET used_at = NOW()
+	WHERE id = (
+		SELECT id FROM mfa_recovery_codes
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+		LIMIT 1
+	)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return rows == 1, nil
+}
+
+func (s *MFAStore) replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userID int64, codeHashes []string) error {
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	query := `DELETE FROM mfa_recovery_codes WHERE user_id = $1`
+	if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+		return err
+	}
+
+	query = `INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, userID, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
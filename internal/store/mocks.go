@@ -3,14 +3,39 @@ package store
 import (
 	"context"
 	"database/sql"
+	"sync"
 	"time"
 )
 
 func NewMockStore() Storage {
-	return Storage{Users: &MockUserStore{}}
+	return Storage{
+		Users:                &MockUserStore{},
+		Posts:                &MockPostStore{},
+		Comments:             &MockCommentStore{},
+		Reactions:            &MockReactionStore{},
+		RefreshTokens:        NewMockRefreshTokenStore(),
+		Followers:            NewMockFollowerStore(),
+		Role:                 &MockRoleStore{},
+		Audit:                &MockAuditStore{},
+		PersonalAccessTokens: &MockPersonalAccessTokenStore{},
+		Search:               &MockSearchStore{},
+		Tags:                 &MockTagStore{},
+	}
 }
 
+// MockUserStore loads users 2 and 3 as a moderator and an admin and user 4 with the custom
+// support role, other users have no role. User 5 has the password "password".
+// Suspended, Deleted and Updated record the users the calls were made for
 type MockUserStore struct {
+	Suspended []int64
+	Deleted   []int64
+	Updated   []int64
+}
+
+var mockStaffRoles = map[int64]Role{
+	2: {ID: 2, Name: "moderator", Level: 2},
+	3: {ID: 3, Name: "admin", Level: 3},
+	4: {ID: 4, Name: "support"},
 }
 
 func (m *MockUserStore) Create(ctx context.Context, tx *sql.Tx, u *User) error {
@@ -21,18 +46,410 @@ func (m *MockUserStore) Activate(ctx context.Context, token string) error {
 	return nil
 }
 
+// ResendInvitation finds an inactive user for every email but unknown@example.com and active@example.com
+func (m *MockUserStore) ResendInvitation(ctx context.Context, email string, hashToken string, exp time.Duration) (*User, error) {
+	if email == "unknown@example.com" || email == "active@example.com" {
+		return nil, ErrorNotFound
+	}
+	return &User{Email: email}, nil
+}
+
+func (m *MockUserStore) PurgeExpiredInvitations(ctx context.Context) (int64, int64, error) {
+	return 0, 0, nil
+}
+
+func (m *MockUserStore) SetRole(ctx context.Context, userID int64, roleID int64) error {
+	return nil
+}
+
+func (m *MockUserStore) GetAnyById(ctx context.Context, userID int64) (*User, error) {
+	return &User{ID: userID, Role: mockStaffRoles[userID]}, nil
+}
+
+func (m *MockUserStore) GetActiveIDs(ctx context.Context, afterID int64, limit int) ([]int64, error) {
+	return []int64{}, nil
+}
+
+func (m *MockUserStore) Search(ctx context.Context, q PaginatedUserQuery) ([]*User, error) {
+	return []*User{}, nil
+}
+
+func (m *MockUserStore) Suspend(ctx context.Context, userID int64, until time.Time, reason string) error {
+	m.Suspended = append(m.Suspended, userID)
+	return nil
+}
+
+func (m *MockUserStore) Unsuspend(ctx context.Context, userID int64) error {
+	return nil
+}
+
 func (m *MockUserStore) CreateAndInvite(ctx context.Context, u *User, hashToken string, exp time.Duration) error {
 	return nil
 }
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) error {
+	m.Deleted = append(m.Deleted, userID)
 	return nil
 }
 func (m *MockUserStore) GetById(ctx context.Context, userID int64) (*User, error) {
+	if userID == 5 {
+		user := &User{ID: userID}
+		if err := user.Password.Set("password"); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+	if role, ok := mockStaffRoles[userID]; ok {
+		return &User{ID: userID, Role: role}, nil
+	}
 	return &User{}, nil
 }
 func (m *MockUserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
 	return &User{}, nil
 }
+
+// GetByEmail finds a user for every email but unknown@example.com
 func (m *MockUserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
+	if email == "unknown@example.com" {
+		return nil, ErrorNotFound
+	}
+	return &User{Email: email}, nil
+}
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return nil
+}
+
+// ResetPassword resets the password of user 1 for every token but "expired"
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, password *Password) (*User, error) {
+	if token == "expired" {
+		return nil, ErrorNotFound
+	}
+	return &User{ID: 1}, nil
+}
+
+// MockRefreshTokenStore keeps the refresh tokens in memory so they can be rotated and reused
+type MockRefreshTokenStore struct {
+	sync.Mutex
+	tokens map[string]mockRefreshToken
+}
+
+type mockRefreshToken struct {
+	userID int64
+	expiry time.Time
+}
+
+func NewMockRefreshTokenStore() *MockRefreshTokenStore {
+	return &MockRefreshTokenStore{tokens: make(map[string]mockRefreshToken)}
+}
+
+func (m *MockRefreshTokenStore) Create(ctx context.Context, userID int64, hashToken string, exp time.Duration) error {
+	m.Lock()
+	defer m.Unlock()
+	m.tokens[hashToken] = mockRefreshToken{userID: userID, expiry: time.Now().Add(exp)}
+	return nil
+}
+
+func (m *MockRefreshTokenStore) Rotate(ctx context.Context, oldHashToken, newHashToken string, exp time.Duration) (int64, error) {
+	m.Lock()
+	defer m.Unlock()
+	token, ok := m.tokens[oldHashToken]
+	if !ok || !time.Now().Before(token.expiry) {
+		return 0, ErrorNotFound
+	}
+	delete(m.tokens, oldHashToken)
+	m.tokens[newHashToken] = mockRefreshToken{userID: token.userID, expiry: time.Now().Add(exp)}
+	return token.userID, nil
+}
+
+func (m *MockRefreshTokenStore) Delete(ctx context.Context, userID int64, hashToken string) error {
+	m.Lock()
+	defer m.Unlock()
+	if token, ok := m.tokens[hashToken]; ok && token.userID == userID {
+		delete(m.tokens, hashToken)
+	}
+	return nil
+}
+
+func (m *MockRefreshTokenStore) DeleteByUserID(ctx context.Context, userID int64) error {
+	m.Lock()
+	defer m.Unlock()
+	for hashToken, token := range m.tokens {
+		if token.userID == userID {
+			delete(m.tokens, hashToken)
+		}
+	}
+	return nil
+}
+
+func (m *MockUserStore) UpdateProfile(ctx context.Context, u *User, changes ProfileChanges) error {
+	m.Updated = append(m.Updated, u.ID)
+	return nil
+}
+
+func (m *MockUserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
 	return &User{}, nil
 }
+
+type MockPersonalAccessTokenStore struct{}
+
+func (m *MockPersonalAccessTokenStore) Create(ctx context.Context, t *PersonalAccessToken, hashToken string) error {
+	return nil
+}
+
+func (m *MockPersonalAccessTokenStore) GetByUserID(ctx context.Context, userID int64) ([]PersonalAccessToken, error) {
+	return []PersonalAccessToken{}, nil
+}
+
+func (m *MockPersonalAccessTokenStore) GetByToken(ctx context.Context, hashToken string) (*PersonalAccessToken, error) {
+	return &PersonalAccessToken{ID: 1, UserID: 42, Scopes: []string{"users:read"}}, nil
+}
+
+func (m *MockPersonalAccessTokenStore) Touch(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockPersonalAccessTokenStore) Delete(ctx context.Context, userID int64, id int64) error {
+	return nil
+}
+
+type MockRoleStore struct{}
+
+func (m *MockRoleStore) GetByName(ctx context.Context, roleName string) (*Role, error) {
+	roles, _ := m.GetAll(ctx)
+	for _, role := range roles {
+		if role.Name == roleName {
+			role.Permissions = nil
+			return &role, nil
+		}
+	}
+	return nil, ErrorNotFound
+}
+
+// GetAll returns the seeded roles and a support role, a custom role without a level
+func (m *MockRoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	return []Role{
+		{ID: 1, Name: "user"},
+		{ID: 2, Name: "moderator", Level: 2, Permissions: []string{"comments.delete.any", "comments.update.any", "posts.update.any"}},
+		{ID: 3, Name: "admin", Level: 3, Permissions: []string{"audit.read", "comments.delete.any", "comments.update.any", "posts.delete.any", "posts.update.any", "roles.manage", "users.impersonate", "users.manage"}},
+		{ID: 4, Name: "support", Permissions: []string{"users.manage"}},
+	}, nil
+}
+
+func (m *MockRoleStore) GetPermissions(ctx context.Context) ([]Permission, error) {
+	return []Permission{}, nil
+}
+
+func (m *MockRoleStore) Create(ctx context.Context, role *Role) error {
+	return nil
+}
+
+func (m *MockRoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return nil
+}
+
+type MockAuditStore struct {
+	Events []AuditEvent
+}
+
+func (m *MockAuditStore) Create(ctx context.Context, event *AuditEvent) error {
+	m.Events = append(m.Events, *event)
+	return nil
+}
+
+func (m *MockAuditStore) List(ctx context.Context, q PaginatedAuditQuery) ([]AuditEvent, error) {
+	return m.Events, nil
+}
+
+type MockPostStore struct{}
+
+func (m *MockPostStore) Create(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (m *MockPostStore) GetById(ctx context.Context, postID int64) (*Post, error) {
+	return &Post{ID: postID}, nil
+}
+
+func (m *MockPostStore) DeleteById(ctx context.Context, postID int64) error {
+	return nil
+}
+
+func (m *MockPostStore) UpdatePostById(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (m *MockPostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return []*PostWithMetadata{}, &FeedCursors{}, nil
+}
+
+func (m *MockPostStore) GetUserPosts(ctx context.Context, viewerID, authorID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return []*PostWithMetadata{}, &FeedCursors{}, nil
+}
+
+func (m *MockPostStore) GetExploreFeed(ctx context.Context, viewerID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return []*PostWithMetadata{}, &FeedCursors{}, nil
+}
+
+func (m *MockPostStore) GetRankedFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (m *MockPostStore) GetTagPosts(ctx context.Context, viewerID, tagID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return []*PostWithMetadata{}, &FeedCursors{}, nil
+}
+
+func (m *MockPostStore) GetFollowedTagEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+func (m *MockPostStore) GetFeedByIDs(ctx context.Context, viewerID int64, ids []int64) ([]*PostWithMetadata, error) {
+	return []*PostWithMetadata{}, nil
+}
+
+func (m *MockPostStore) GetTimelineEntries(ctx context.Context, authorIDs []int64, limit int) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+type MockReactionStore struct{}
+
+func (m *MockReactionStore) Set(ctx context.Context, postID, userID int64, reaction string) error {
+	return nil
+}
+
+func (m *MockReactionStore) Delete(ctx context.Context, postID, userID int64, reaction string) error {
+	return nil
+}
+
+type MockCommentStore struct{}
+
+func (m *MockCommentStore) List(ctx context.Context, postID int64, q PaginatedCommentQuery) ([]Comment, string, error) {
+	return []Comment{}, "", nil
+}
+
+func (m *MockCommentStore) GetReplies(ctx context.Context, commentIDs []int64, limit int) ([]Comment, map[int64]string, error) {
+	return []Comment{}, map[int64]string{}, nil
+}
+
+func (m *MockCommentStore) GetThreadReplies(ctx context.Context, commentID int64, q PaginatedReplyQuery) ([]Comment, string, error) {
+	if q.Cursor != "" {
+		var cursor replyCursor
+		if err := decodeCursor(q.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	return []Comment{}, "", nil
+}
+
+func (m *MockCommentStore) CountByPostID(ctx context.Context, postID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *MockCommentStore) GetById(ctx context.Context, commentID int64) (*Comment, error) {
+	return &Comment{ID: commentID, PostID: 1, UserID: commentID}, nil
+}
+
+func (m *MockCommentStore) Create(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (m *MockCommentStore) Update(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (m *MockCommentStore) Delete(ctx context.Context, commentID int64) error {
+	return nil
+}
+
+func (m *MockCommentStore) Remove(ctx context.Context, commentID int64) error {
+	return nil
+}
+
+// MockFollowerStore keeps in memory who follows who
+type MockFollowerStore struct {
+	sync.Mutex
+	following map[int64]map[int64]bool
+}
+
+func NewMockFollowerStore() *MockFollowerStore {
+	return &MockFollowerStore{following: make(map[int64]map[int64]bool)}
+}
+
+func (m *MockFollowerStore) Follow(ctx context.Context, followedID int64, userID int64) error {
+	m.Lock()
+	defer m.Unlock()
+	if m.following[userID] == nil {
+		m.following[userID] = make(map[int64]bool)
+	}
+	if m.following[userID][followedID] {
+		return ErrorConflict
+	}
+	m.following[userID][followedID] = true
+	return nil
+}
+
+func (m *MockFollowerStore) Unfollow(ctx context.Context, followedID int64, userID int64) error {
+	m.Lock()
+	defer m.Unlock()
+	delete(m.following[userID], followedID)
+	return nil
+}
+
+func (m *MockFollowerStore) GetFollowerIDs(ctx context.Context, userID int64, limit int) ([]int64, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.followerIDs(userID, limit), nil
+}
+
+func (m *MockFollowerStore) GetFollowing(ctx context.Context, userID int64) ([]FollowedUser, error) {
+	m.Lock()
+	defer m.Unlock()
+	following := []FollowedUser{}
+	for id := range m.following[userID] {
+		following = append(following, FollowedUser{ID: id, Followers: len(m.followerIDs(id, -1))})
+	}
+	return following, nil
+}
+
+// followerIDs returns up to limit followers of the user, all of them when limit is negative
+func (m *MockFollowerStore) followerIDs(userID int64, limit int) []int64 {
+	ids := []int64{}
+	for id, followed := range m.following {
+		if followed[userID] && (limit < 0 || len(ids) < limit) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+type MockSearchStore struct{}
+
+func (m *MockSearchStore) Search(ctx context.Context, q PaginatedSearchQuery) ([]SearchHit, string, error) {
+	if q.Cursor != "" {
+		var cursor searchCursor
+		if err := decodeCursor(q.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+	}
+	return []SearchHit{}, "", nil
+}
+
+type MockTagStore struct{}
+
+func (m *MockTagStore) GetByName(ctx context.Context, name string) (*Tag, error) {
+	if name != "go" {
+		return nil, ErrorNotFound
+	}
+	return &Tag{ID: 1, Name: name}, nil
+}
+
+func (m *MockTagStore) Follow(ctx context.Context, userID, tagID int64) error {
+	return nil
+}
+
+func (m *MockTagStore) Unfollow(ctx context.Context, userID, tagID int64) error {
+	return nil
+}
+
+func (m *MockTagStore) GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	return []TrendingTag{}, nil
+}
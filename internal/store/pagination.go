@@ -1,6 +1,8 @@
 package store
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -11,11 +13,36 @@ type PaginatedFeedQuery struct {
 	Limit     int      `json:"limit" validate:"gte=1,lte=20"`
 	Offset    int      `json:"offset" validate:"gte=0"`
 	SortOrder string   `json:"sort_order" validate:"oneof=asc desc"`
-	SortBy    string   `json:"sort_by" validate:"oneof=title content created_at"`
+	SortBy    string   `json:"sort_by" validate:"oneof=title content created_at popular"`
 	Tags      []string `json:"tags" validate:"max=5"`
 	Search    string   `json:"search" validate:"max=100"`
-	Since     string   `json:"since" validate:"max=100"`
-	Until     string   `json:"until" validate:"max=100"`
+	// Since and Until are RFC 3339 times, times without an offset (2006-01-02 15:04:05 or
+	// 2006-01-02) in the TZ location, or durations before now like 24h or 7d
+	Since string `json:"since" validate:"max=100"`
+	Until string `json:"until" validate:"max=100"`
+	TZ    string `json:"tz" validate:"max=100"`
+	// From and To are the time range resolved from Since and Until by ResolveTimeRange
+	From *time.Time `json:"-"`
+	To   *time.Time `json:"-"`
+	// Ranking orders the feed with one of the FeedRankers instead of SortBy, ranked feeds page by offset
+	Ranking string `json:"ranking" validate:"omitempty,oneof=chronological engagement affinity"`
+	// Keyset pages by cursor instead of offset, Cursor is empty for the first page. The cap fits
+	// the largest cursor, a content sort keyed by 1000 characters taking up to 6 bytes of json each
+	Keyset bool   `json:"keyset"`
+	Cursor string `json:"cursor" validate:"max=8500"`
+	// Position is where the page starts, decoded from the cursor
+	Position *FeedPosition `json:"-"`
+}
+
+// FeedPosition is the keyset position of a post in a feed sorted by SortBy and SortOrder
+type FeedPosition struct {
+	SortBy    string `json:"sort_by"`
+	SortOrder string `json:"sort_order"`
+	// Key is the value of the sort column of the post
+	Key string `json:"key"`
+	ID  int64  `json:"id"`
+	// Before pages back to the posts before the position
+	Before bool `json:"before,omitempty"`
 }
 
 func (fq PaginatedFeedQuery) Parse(r *http.Request) PaginatedFeedQuery {
@@ -28,6 +55,8 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) PaginatedFeedQuery {
 	search := qs.Get("search")
 	since := qs.Get("since")
 	until := qs.Get("until")
+	ranking := qs.Get("ranking")
+	tz := qs.Get("tz")
 
 	if limit != "" {
 		l, err := strconv.Atoi(limit)
@@ -53,22 +82,332 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) PaginatedFeedQuery {
 		fq.Search = search
 	}
 	if tags != "" {
-		fq.Tags = strings.Split(tags, ",")
+		fq.Tags = NormalizeTags(strings.Split(tags, ","))
 	}
 	if since != "" {
-		fq.Since = parseTime(since)
+		fq.Since = since
 	}
 	if until != "" {
-		fq.Until = parseTime(until)
+		fq.Until = until
+	}
+	if tz != "" {
+		fq.TZ = tz
+	}
+	if ranking != "" {
+		fq.Ranking = ranking
+	}
+	if qs.Has("cursor") {
+		fq.Keyset = true
+		fq.Cursor = qs.Get("cursor")
 	}
 
 	return fq
 }
 
-func parseTime(str string) string {
-	t, err := time.Parse(time.DateTime, str)
+// ResolveTimeRange sets From and To from Since and Until, relative to now
+func (fq PaginatedFeedQuery) ResolveTimeRange(now time.Time) (PaginatedFeedQuery, error) {
+	loc := time.UTC
+	if fq.TZ != "" {
+		l, err := time.LoadLocation(fq.TZ)
+		if err != nil {
+			return fq, fmt.Errorf("invalid tz %q", fq.TZ)
+		}
+		loc = l
+	}
+
+	var err error
+	if fq.From, err = parseFeedTime(fq.Since, now, loc); err != nil {
+		return fq, fmt.Errorf("invalid since: %w", err)
+	}
+	if fq.To, err = parseFeedTime(fq.Until, now, loc); err != nil {
+		return fq, fmt.Errorf("invalid until: %w", err)
+	}
+	if fq.From != nil && fq.To != nil && fq.From.After(*fq.To) {
+		return fq, errors.New("since must be before until")
+	}
+	return fq, nil
+}
+
+// parseFeedTime parses an absolute time or a duration before now, nil for an empty string
+func parseFeedTime(str string, now time.Time, loc *time.Location) (*time.Time, error) {
+	if str == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, str); err == nil {
+		return &t, nil
+	}
+	for _, layout := range []string{time.DateTime, time.DateOnly} {
+		if t, err := time.ParseInLocation(layout, str, loc); err == nil {
+			return &t, nil
+		}
+	}
+	d, err := ParseDuration(str)
 	if err != nil {
-		return ""
+		return nil, fmt.Errorf("%q is not a time or a duration", str)
+	}
+	if d < 0 {
+		return nil, fmt.Errorf("duration %q is negative", str)
+	}
+	t := now.Add(-d)
+	return &t, nil
+}
+
+// ParseDuration parses the durations of time.ParseDuration and whole days like 7d
+func ParseDuration(str string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(str, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * time.Hour * 24, nil
+	}
+	return time.ParseDuration(str)
+}
+
+type PaginatedUserQuery struct {
+	Limit  int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset int    `json:"offset" validate:"gte=0"`
+	Search string `json:"search" validate:"max=100"`
+	Role   string `json:"role" validate:"max=100"`
+	// Active filters on the activation status when set
+	Active *bool `json:"active"`
+}
+
+func (uq PaginatedUserQuery) Parse(r *http.Request) PaginatedUserQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+	offset := qs.Get("offset")
+	active := qs.Get("active")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return uq
+		}
+		uq.Limit = l
+	}
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return uq
+		}
+		uq.Offset = o
+	}
+	if active != "" {
+		a, err := strconv.ParseBool(active)
+		if err != nil {
+			return uq
+		}
+		uq.Active = &a
+	}
+	uq.Search = qs.Get("search")
+	uq.Role = qs.Get("role")
+
+	return uq
+}
+
+type PaginatedAuditQuery struct {
+	Limit      int    `json:"limit" validate:"gte=1,lte=100"`
+	Offset     int    `json:"offset" validate:"gte=0"`
+	ActorID    *int64 `json:"actor_id"`
+	Action     string `json:"action" validate:"max=100"`
+	TargetType string `json:"target_type" validate:"max=50"`
+	TargetID   *int64 `json:"target_id"`
+	// Since and Until are RFC 3339 times, or times without an offset (2006-01-02 15:04:05 or
+	// 2006-01-02) in UTC
+	Since string `json:"since" validate:"max=100"`
+	Until string `json:"until" validate:"max=100"`
+	// From and To are the time range resolved from Since and Until by ResolveTimeRange
+	From *time.Time `json:"-"`
+	To   *time.Time `json:"-"`
+}
+
+func (aq PaginatedAuditQuery) Parse(r *http.Request) PaginatedAuditQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+	offset := qs.Get("offset")
+	actorID := qs.Get("actor_id")
+	targetID := qs.Get("target_id")
+	since := qs.Get("since")
+	until := qs.Get("until")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return aq
+		}
+		aq.Limit = l
+	}
+	if offset != "" {
+		o, err := strconv.Atoi(offset)
+		if err != nil {
+			return aq
+		}
+		aq.Offset = o
+	}
+	if actorID != "" {
+		id, err := strconv.ParseInt(actorID, 10, 64)
+		if err != nil {
+			return aq
+		}
+		aq.ActorID = &id
+	}
+	if targetID != "" {
+		id, err := strconv.ParseInt(targetID, 10, 64)
+		if err != nil {
+			return aq
+		}
+		aq.TargetID = &id
 	}
-	return t.Format(time.DateTime)
+	if since != "" {
+		aq.Since = since
+	}
+	if until != "" {
+		aq.Until = until
+	}
+	aq.Action = qs.Get("action")
+	aq.TargetType = qs.Get("target_type")
+
+	return aq
+}
+
+// ResolveTimeRange sets From and To from Since and Until, a time which does not parse is an
+// error rather than no filter
+func (aq PaginatedAuditQuery) ResolveTimeRange() (PaginatedAuditQuery, error) {
+	var err error
+	if aq.From, err = parseAuditTime(aq.Since); err != nil {
+		return aq, fmt.Errorf("invalid since: %w", err)
+	}
+	if aq.To, err = parseAuditTime(aq.Until); err != nil {
+		return aq, fmt.Errorf("invalid until: %w", err)
+	}
+	if aq.From != nil && aq.To != nil && aq.From.After(*aq.To) {
+		return aq, errors.New("since must be before until")
+	}
+	return aq, nil
+}
+
+// parseAuditTime parses an RFC 3339 time or a time without an offset in UTC, nil for an empty string
+func parseAuditTime(str string) (*time.Time, error) {
+	if str == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, str); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%q is not a time", str)
+}
+
+type PaginatedCommentQuery struct {
+	Limit int `json:"limit" validate:"gte=1,lte=100"`
+	// Sort is newest or oldest first, or top for the comments with the most replies first
+	Sort string `json:"sort" validate:"oneof=newest oldest top"`
+	// Cursor is the next_cursor of the previous page, empty for the first page
+	Cursor string `json:"cursor" validate:"max=200"`
+	// View returns the replies flattened with their depth, or nested as a tree
+	View string `json:"view" validate:"oneof=flat tree"`
+}
+
+func (cq PaginatedCommentQuery) Parse(r *http.Request) PaginatedCommentQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+	sort := qs.Get("sort")
+	view := qs.Get("view")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return cq
+		}
+		cq.Limit = l
+	}
+	if sort != "" {
+		cq.Sort = sort
+	}
+	if view != "" {
+		cq.View = view
+	}
+	cq.Cursor = qs.Get("cursor")
+
+	return cq
+}
+
+// PaginatedReplyQuery pages the replies below a comment in thread order
+type PaginatedReplyQuery struct {
+	Limit int `json:"limit" validate:"gte=1,lte=100"`
+	// Cursor is the next_cursor of the previous page, or the replies_cursor of a listed comment
+	Cursor string `json:"cursor" validate:"max=500"`
+}
+
+func (rq PaginatedReplyQuery) Parse(r *http.Request) PaginatedReplyQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return rq
+		}
+		rq.Limit = l
+	}
+	rq.Cursor = qs.Get("cursor")
+
+	return rq
+}
+
+type PaginatedSearchQuery struct {
+	// Query uses the web search syntax: "quoted phrases", -excluded words and OR
+	Query string `json:"q" validate:"required,max=200"`
+	Type  string `json:"type" validate:"oneof=posts comments users"`
+	Limit int    `json:"limit" validate:"gte=1,lte=50"`
+	// Cursor is the next_cursor of the previous page, empty for the first page
+	Cursor string `json:"cursor" validate:"max=200"`
+}
+
+func (sq PaginatedSearchQuery) Parse(r *http.Request) PaginatedSearchQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+	searchType := qs.Get("type")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return sq
+		}
+		sq.Limit = l
+	}
+	if searchType != "" {
+		sq.Type = searchType
+	}
+	sq.Query = qs.Get("q")
+	sq.Cursor = qs.Get("cursor")
+
+	return sq
+}
+
+type TrendingTagsQuery struct {
+	// Window is the duration uses are counted over, like 24h or 7d
+	Window string `json:"window" validate:"max=20"`
+	Limit  int    `json:"limit" validate:"gte=1,lte=50"`
+}
+
+func (tq TrendingTagsQuery) Parse(r *http.Request) TrendingTagsQuery {
+	qs := r.URL.Query()
+	limit := qs.Get("limit")
+	window := qs.Get("window")
+
+	if limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return tq
+		}
+		tq.Limit = l
+	}
+	if window != "" {
+		tq.Window = window
+	}
+
+	return tq
 }
@@ -0,0 +1,63 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResolveTimeRange(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name         string
+		fq           PaginatedFeedQuery
+		expectedFrom time.Time
+		expectedTo   time.Time
+	}{
+		{
+			name:         "rfc 3339 with offset",
+			fq:           PaginatedFeedQuery{Since: "2024-03-01T10:00:00+02:00"},
+			expectedFrom: time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC),
+		},
+		{
+			name:         "date time in the time zone",
+			fq:           PaginatedFeedQuery{Since: "2024-03-01 10:00:00", Until: "2024-03-02", TZ: "Asia/Kolkata"},
+			expectedFrom: time.Date(2024, 3, 1, 4, 30, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, 3, 1, 18, 30, 0, 0, time.UTC),
+		},
+		{
+			name:         "relative",
+			fq:           PaginatedFeedQuery{Since: "7d", Until: "24h"},
+			expectedFrom: time.Date(2024, 3, 3, 12, 0, 0, 0, time.UTC),
+			expectedTo:   time.Date(2024, 3, 9, 12, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, c := range cases {
+		t.Run("should resolve "+c.name, func(t *testing.T) {
+			fq, err := c.fq.ResolveTimeRange(now)
+			if err != nil {
+				t.Fatalf("could not resolve the range: %v", err)
+			}
+			if fq.From == nil || !fq.From.Equal(c.expectedFrom) {
+				t.Errorf("expected from %v, got %v", c.expectedFrom, fq.From)
+			}
+			if c.expectedTo.IsZero() != (fq.To == nil) || fq.To != nil && !fq.To.Equal(c.expectedTo) {
+				t.Errorf("expected to %v, got %v", c.expectedTo, fq.To)
+			}
+		})
+	}
+
+	invalid := map[string]PaginatedFeedQuery{
+		"an unknown format": {Since: "yesterday"},
+		"a negative range":  {Since: "-24h"},
+		"an unknown zone":   {Since: "2024-03-01", TZ: "Mars/Olympus"},
+		"since after until": {Since: "1h", Until: "2d"},
+	}
+	for name, fq := range invalid {
+		t.Run("should reject "+name, func(t *testing.T) {
+			if _, err := fq.ResolveTimeRange(now); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
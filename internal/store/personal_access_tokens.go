@@ -0,0 +1,149 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+type PersonalAccessToken struct {
+	ID         int64      `json:"id"`
+	UserID     int64      `json:"user_id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  string     `json:"created_at"`
+}
+
+// HasScope reports whether the token was granted scope
+func (t *PersonalAccessToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type PersonalAccessTokenStore struct {
+	db *sql.DB
+}
+
+func (s *PersonalAccessTokenStore) Create(ctx context.Context, token *PersonalAccessToken, hashToken string) error {
+	query := `INSERT INTO personal_access_tokens (user_id, name, token, scopes, expires_at)
+	VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		token.UserID,
+		token.Name,
+		hashToken,
+		pq.Array(token.Scopes),
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (s *PersonalAccessTokenStore) GetByUserID(ctx context.Context, userID int64) ([]PersonalAccessToken, error) {
+	query := `SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM personal_access_tokens
+	WHERE user_id = $1
+	ORDER BY created_at DESC`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []PersonalAccessToken{}
+	for rows.Next() {
+		var t PersonalAccessToken
+		err := rows.Scan(
+			&t.ID,
+			&t.UserID,
+			&t.Name,
+			pq.Array(&t.Scopes),
+			&t.ExpiresAt,
+			&t.LastUsedAt,
+			&t.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// GetByToken returns the unexpired token with the given hash
+func (s *PersonalAccessTokenStore) GetByToken(ctx context.Context, hashToken string) (*PersonalAccessToken, error) {
+	query := `SELECT id, user_id, name, scopes, expires_at, last_used_at, created_at
+	FROM personal_access_tokens
+	WHERE token = $1 AND (expires_at IS NULL OR expires_at > $2)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var t PersonalAccessToken
+	err := s.db.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+		&t.ID,
+		&t.UserID,
+		&t.Name,
+		pq.Array(&t.Scopes),
+		&t.ExpiresAt,
+		&t.LastUsedAt,
+		&t.CreatedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &t, nil
+}
+
+// Touch updates the last used timestamp, at most once a minute to keep writes off the hot path
+func (s *PersonalAccessTokenStore) Touch(ctx context.Context, id int64) error {
+	query := `UPDATE personal_access_tokens SET last_used_at = NOW()
+	WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *PersonalAccessTokenStore) Delete(ctx context.Context, userID int64, id int64) error {
+	query := `DELETE FROM personal_access_tokens WHERE id = $1 AND user_id = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
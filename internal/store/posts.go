@@ -3,8 +3,13 @@ package store
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -26,7 +31,36 @@ type PostWithMetadata struct {
 	Post           Post     `json:"post"`
 	CommentCount   int      `json:"comment_count"`
 	LatestComments []string `json:"latest_comments"`
+	// ReactionCounts is the number of reactions per type
+	ReactionCounts map[string]int `json:"reaction_counts"`
+	// ViewerReaction is the reaction of the user reading the feed, nil without one
+	ViewerReaction *string `json:"viewer_reaction"`
 }
+
+// FeedCursors are the positions of the pages around a feed page, nil when there is no such page
+type FeedCursors struct {
+	Next *FeedPosition
+	Prev *FeedPosition
+}
+
+// feedSortColumns maps the feed sorts to their column and the type keyset values are cast to
+var feedSortColumns = map[string]struct{ column, cast string }{
+	"created_at": {"p.created_at", "TIMESTAMPTZ"},
+	"title":      {"p.title", "TEXT"},
+	"content":    {"p.content", "TEXT"},
+	"popular":    {feedPopularity, "BIGINT"},
+}
+
+// feedPopularity is the number of comments and reactions of a post
+const feedPopularity = `((SELECT COUNT(*) FROM comments WHERE post_id = p.id) +
+		COALESCE((SELECT SUM(value::BIGINT) FROM jsonb_each_text(p.reaction_counts)), 0))`
+
+// feedScope is the condition selecting the posts of a feed, arg is bound to $10 when not nil
+type feedScope struct {
+	where string
+	arg   any
+}
+
 type PostStore struct {
 	db *sql.DB
 }
@@ -117,7 +151,52 @@ func (s *PostStore) UpdatePostById(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+// GetUserFeed returns a page of the feed of the user, the posts of the user, the users followed
+// and the tags followed
+func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	scope := feedScope{
+		where: `(p.user_id = $10 OR
+			p.user_id IN (SELECT follower_id FROM followers WHERE user_id = $10) OR
+			p.id IN (SELECT pt.post_id FROM post_tags pt JOIN tag_follows tf ON tf.tag_id = pt.tag_id WHERE tf.user_id = $10))`,
+		arg: id,
+	}
+	return s.getFeed(ctx, id, scope, fq)
+}
+
+// GetTagPosts returns a page of the posts with the tag, as seen by the viewer
+func (s *PostStore) GetTagPosts(ctx context.Context, viewerID, tagID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return s.getFeed(ctx, viewerID, feedScope{where: `p.id IN (SELECT post_id FROM post_tags WHERE tag_id = $10)`, arg: tagID}, fq)
+}
+
+// GetUserPosts returns a page of the posts of the author, as seen by the viewer
+func (s *PostStore) GetUserPosts(ctx context.Context, viewerID, authorID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return s.getFeed(ctx, viewerID, feedScope{where: `p.user_id = $10`, arg: authorID}, fq)
+}
+
+// GetExploreFeed returns a page of the posts of every user, as seen by the viewer
+func (s *PostStore) GetExploreFeed(ctx context.Context, viewerID int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	return s.getFeed(ctx, viewerID, feedScope{where: `TRUE`}, fq)
+}
+
+// getFeed returns a page of the posts of the scope matching the filters of the query. In keyset
+// mode the page starts at fq.Position and the positions of the pages around it are returned,
+// offset paging returns no cursors
+func (s *PostStore) getFeed(ctx context.Context, viewerID int64, scope feedScope, fq PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error) {
+	sort, ok := feedSortColumns[fq.SortBy]
+	if !ok {
+		sort = feedSortColumns["created_at"]
+	}
+	// paging back walks the feed in the opposite order, the page is reversed after reading it
+	order := strings.ToUpper(fq.SortOrder)
+	before := fq.Position != nil && fq.Position.Before
+	if before {
+		order = map[string]string{"ASC": "DESC", "DESC": "ASC"}[order]
+	}
+	after := ">"
+	if order == "DESC" {
+		after = "<"
+	}
+
 	query := fmt.Sprintf(`SELECT 
     p.id, 
     p.user_id, 
@@ -128,55 +207,245 @@ func (s *PostStore) GetUserFeed(ctx context.Context, id int64, fq PaginatedFeedQ
     p.tags, 
     u.username,
     COUNT(c.id) AS comments_count,
-    COALESCE(
+    %[5]s
+	FROM posts p
+	LEFT JOIN users u ON u.id = p.user_id
+	LEFT JOIN comments c ON c.post_id = p.id
+	WHERE 
+		%[6]s AND
+		(p.title ILIKE '%%' || $4 || '%%' OR p.content ILIKE '%%' || $4 || '%%') AND
+		(p.tags @> $5 OR $5 IS NULL OR $5 = '{}'::VARCHAR[]) AND
+		($8::TIMESTAMPTZ IS NULL OR p.created_at >= $8) AND
+		($9::TIMESTAMPTZ IS NULL OR p.created_at <= $9) AND
+		($7::BIGINT IS NULL OR (%[1]s, p.id) %[2]s ($6::%[3]s, $7))
+	GROUP BY p.id, u.username
+	ORDER BY %[1]s %[4]s, p.id %[4]s
+	LIMIT $2 OFFSET $3;
+	`, sort.column, after, sort.cast, order, feedMetadataColumns, scope.where)
+
+	limit, offset := fq.Limit, fq.Offset
+	var key *string
+	var keyID *int64
+	if fq.Keyset {
+		// one more row than the limit tells whether the feed goes on
+		limit, offset = fq.Limit+1, 0
+		if fq.Position != nil {
+			key, keyID = &fq.Position.Key, &fq.Position.ID
+		}
+	}
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+	args := []any{viewerID, limit, offset, fq.Search, pq.Array(fq.Tags), key, keyID, fq.From, fq.To}
+	if scope.arg != nil {
+		args = append(args, scope.arg)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	feed := []*PostWithMetadata{}
+	for rows.Next() {
+		post, err := scanFeedPost(rows)
+		if err != nil {
+			return nil, nil, err
+		}
+		feed = append(feed, post)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if !fq.Keyset {
+		return feed, nil, nil
+	}
+
+	more := len(feed) > fq.Limit
+	if more {
+		feed = feed[:fq.Limit]
+	}
+	if before {
+		slices.Reverse(feed)
+	}
+
+	cursors := &FeedCursors{}
+	if len(feed) == 0 {
+		return feed, cursors, nil
+	}
+	// going forward there are posts before the page when it started at a cursor, and posts after
+	// it when the limit was exceeded. Going back it is the other way around
+	if more || before {
+		cursors.Next = feedPosition(fq, feed[len(feed)-1], false)
+	}
+	if (before && more) || (!before && fq.Position != nil) {
+		cursors.Prev = feedPosition(fq, feed[0], true)
+	}
+	return feed, cursors, nil
+}
+
+// feedMetadataColumns are the columns after the comment count of a feed post, $1 is the viewer
+const feedMetadataColumns = `COALESCE(
         (SELECT ARRAY_AGG(lc.comment_content ORDER BY lc.comment_created_at DESC) 
          FROM (
              SELECT content AS comment_content, created_at AS comment_created_at 
              FROM comments 
-             WHERE post_id = p.id AND content IS NOT NULL
+             WHERE post_id = p.id AND content IS NOT NULL AND removed_at IS NULL
              ORDER BY created_at DESC 
              LIMIT 2
          ) lc),
         '{}'::TEXT[]
-    ) AS latest_comments
+    ) AS latest_comments,
+    p.reaction_counts,
+    (SELECT type FROM post_reactions WHERE post_id = p.id AND user_id = $1) AS viewer_reaction`
+
+func scanFeedPost(rows *sql.Rows) (*PostWithMetadata, error) {
+	var post PostWithMetadata
+	var reactionCounts []byte
+	err := rows.Scan(
+		&post.Post.ID,
+		&post.Post.UserID,
+		&post.Post.Title,
+		&post.Post.Content,
+		&post.Post.CreatedAt,
+		&post.Post.Version,
+		pq.Array(&post.Post.Tags),
+		&post.Post.User.Username,
+		&post.CommentCount,
+		pq.Array(&post.LatestComments),
+		&reactionCounts,
+		&post.ViewerReaction,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(reactionCounts, &post.ReactionCounts); err != nil {
+		return nil, err
+	}
+	return &post, nil
+}
+
+// GetFeedByIDs returns the posts with the feed metadata for the viewer in the order of ids,
+// posts which no longer exist are left out
+func (s *PostStore) GetFeedByIDs(ctx context.Context, viewerID int64, ids []int64) ([]*PostWithMetadata, error) {
+	query := `SELECT
+    p.id,
+    p.user_id,
+    p.title,
+    p.content,
+    p.created_at,
+    p.version,
+    p.tags,
+    u.username,
+    (SELECT COUNT(*) FROM comments WHERE post_id = p.id) AS comments_count,
+    ` + feedMetadataColumns + `
 	FROM posts p
 	LEFT JOIN users u ON u.id = p.user_id
-	LEFT JOIN followers f ON f.follower_id = p.user_id
-	LEFT JOIN comments c ON c.post_id = p.id
-	WHERE 
-		(f.user_id = $1 OR p.user_id = $1 ) AND
-		(p.title ILIKE '%%' || $4 || '%%' OR p.content ILIKE '%%' || $4 || '%%') AND
-		(p.tags @> $5 OR $5 IS NULL OR $5 = '{}'::VARCHAR[])
-	GROUP BY p.id, u.username
-	ORDER BY %s %s
-	LIMIT $2 OFFSET $3;
-	`, fq.SortBy, fq.SortOrder)
+	WHERE p.id = ANY($2)
+	ORDER BY array_position($2, p.id)`
 
 	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
 	defer cancelCtx()
-	rows, err := s.db.QueryContext(ctx, query, id, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+
+	rows, err := s.db.QueryContext(ctx, query, viewerID, pq.Array(ids))
 	if err != nil {
 		return nil, err
 	}
-	var feed []*PostWithMetadata
+	defer rows.Close()
+
+	feed := []*PostWithMetadata{}
 	for rows.Next() {
-		var post PostWithMetadata
-		err := rows.Scan(
-			&post.Post.ID,
-			&post.Post.UserID,
-			&post.Post.Title,
-			&post.Post.Content,
-			&post.Post.CreatedAt,
-			&post.Post.Version,
-			pq.Array(&post.Post.Tags),
-			&post.Post.User.Username,
-			&post.CommentCount,
-			pq.Array(&post.LatestComments),
-		)
+		post, err := scanFeedPost(rows)
 		if err != nil {
 			return nil, err
 		}
-		feed = append(feed, &post)
+		feed = append(feed, post)
+	}
+	return feed, rows.Err()
+}
+
+// TimelineEntry is a post in a cached timeline
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
+// GetTimelineEntries returns the latest posts of the authors, newest first
+func (s *PostStore) GetTimelineEntries(ctx context.Context, authorIDs []int64, limit int) ([]TimelineEntry, error) {
+	query := `SELECT id, created_at FROM posts
+	WHERE user_id = ANY($1)
+	ORDER BY created_at DESC, id DESC
+	LIMIT $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, pq.Array(authorIDs), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// GetFollowedTagEntries returns the latest posts with the tags the user follows, newest first
+func (s *PostStore) GetFollowedTagEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	query := `SELECT DISTINCT p.id, p.created_at FROM posts p
+	JOIN post_tags pt ON pt.post_id = p.id
+	JOIN tag_follows tf ON tf.tag_id = pt.tag_id
+	WHERE tf.user_id = $1
+	ORDER BY p.created_at DESC, p.id DESC
+	LIMIT $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []TimelineEntry{}
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func feedPosition(fq PaginatedFeedQuery, post *PostWithMetadata, before bool) *FeedPosition {
+	pos := &FeedPosition{
+		SortBy:    fq.SortBy,
+		SortOrder: fq.SortOrder,
+		ID:        post.Post.ID,
+		Before:    before,
+	}
+	switch fq.SortBy {
+	case "title":
+		pos.Key = post.Post.Title
+	case "content":
+		pos.Key = post.Post.Content
+	case "popular":
+		popularity := post.CommentCount
+		for _, count := range post.ReactionCounts {
+			popularity += count
+		}
+		pos.Key = strconv.Itoa(popularity)
+	default:
+		pos.Key = post.Post.CreatedAt
 	}
-	return feed, nil
+	return pos
 }
@@ -0,0 +1,180 @@
+package store
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// rankCandidates is the number of latest feed posts a ranked feed is built from
+const rankCandidates = 500
+
+// RankingContext is what rankers know besides the posts, Now is passed in so scores are reproducible
+type RankingContext struct {
+	Now time.Time
+	// TagAffinity is the interest of the viewer in a tag, from 0 to 1
+	TagAffinity map[string]float64
+}
+
+// FeedRanker scores feed posts, higher scores come first
+type FeedRanker interface {
+	Score(post *PostWithMetadata, rc RankingContext) float64
+}
+
+// ChronologicalRanker ranks the newest posts first
+type ChronologicalRanker struct{}
+
+func (ChronologicalRanker) Score(post *PostWithMetadata, rc RankingContext) float64 {
+	createdAt, err := time.Parse(time.RFC3339Nano, post.Post.CreatedAt)
+	if err != nil {
+		return 0
+	}
+	return float64(createdAt.Unix())
+}
+
+// EngagementRanker ranks posts by their comments and reactions, the score halves every HalfLife
+type EngagementRanker struct {
+	CommentWeight  float64
+	ReactionWeight float64
+	HalfLife       time.Duration
+}
+
+func (r EngagementRanker) Score(post *PostWithMetadata, rc RankingContext) float64 {
+	reactions := 0
+	for _, count := range post.ReactionCounts {
+		reactions += count
+	}
+	engagement := 1 + r.CommentWeight*float64(post.CommentCount) + r.ReactionWeight*float64(reactions)
+	return engagement * decay(post, rc.Now, r.HalfLife)
+}
+
+// TagAffinityRanker ranks posts by the interest of the viewer in their tags, the score halves
+// every HalfLife
+type TagAffinityRanker struct {
+	HalfLife time.Duration
+}
+
+func (r TagAffinityRanker) Score(post *PostWithMetadata, rc RankingContext) float64 {
+	affinity := 1.0
+	for _, tag := range post.Post.Tags {
+		affinity += rc.TagAffinity[tag]
+	}
+	return affinity * decay(post, rc.Now, r.HalfLife)
+}
+
+// FeedRankers are the rankings of the feed by name
+var FeedRankers = map[string]FeedRanker{
+	"chronological": ChronologicalRanker{},
+	"engagement":    EngagementRanker{CommentWeight: 2, ReactionWeight: 1, HalfLife: time.Hour * 12},
+	"affinity":      TagAffinityRanker{HalfLife: time.Hour * 24},
+}
+
+// decay is 1 for new posts and halves every halfLife of the age of the post
+func decay(post *PostWithMetadata, now time.Time, halfLife time.Duration) float64 {
+	createdAt, err := time.Parse(time.RFC3339Nano, post.Post.CreatedAt)
+	if err != nil {
+		return 0
+	}
+	age := now.Sub(createdAt)
+	if age < 0 {
+		age = 0
+	}
+	return math.Pow(0.5, age.Hours()/halfLife.Hours())
+}
+
+// RankFeed sorts the posts by their score, ties keep the newest post first
+func RankFeed(posts []*PostWithMetadata, ranker FeedRanker, rc RankingContext) {
+	scores := make(map[int64]float64, len(posts))
+	for _, post := range posts {
+		scores[post.Post.ID] = ranker.Score(post, rc)
+	}
+	sort.SliceStable(posts, func(i, j int) bool {
+		a, b := posts[i], posts[j]
+		if scores[a.Post.ID] != scores[b.Post.ID] {
+			return scores[a.Post.ID] > scores[b.Post.ID]
+		}
+		return a.Post.ID > b.Post.ID
+	})
+}
+
+// GetRankedFeed ranks the latest posts of the feed of the user with fq.Ranking and returns a page
+// of them by offset
+func (s *PostStore) GetRankedFeed(ctx context.Context, id int64, fq PaginatedFeedQuery) ([]*PostWithMetadata, error) {
+	ranker, ok := FeedRankers[fq.Ranking]
+	if !ok {
+		ranker = ChronologicalRanker{}
+	}
+	rc := RankingContext{Now: time.Now()}
+	if _, ok := ranker.(TagAffinityRanker); ok {
+		affinity, err := s.GetTagAffinity(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		rc.TagAffinity = affinity
+	}
+
+	cq := fq
+	cq.Limit, cq.Offset = rankCandidates, 0
+	cq.SortBy, cq.SortOrder = "created_at", "desc"
+	cq.Keyset, cq.Position = false, nil
+	posts, _, err := s.GetUserFeed(ctx, id, cq)
+	if err != nil {
+		return nil, err
+	}
+
+	RankFeed(posts, ranker, rc)
+	if fq.Offset >= len(posts) {
+		return []*PostWithMetadata{}, nil
+	}
+	return posts[fq.Offset:min(fq.Offset+fq.Limit, len(posts))], nil
+}
+
+// GetTagAffinity weighs the tags of the posts the user wrote or reacted to, the most used tag
+// and the tags the user follows have an affinity of 1
+func (s *PostStore) GetTagAffinity(ctx context.Context, userID int64) (map[string]float64, error) {
+	query := `SELECT tag, COUNT(*), BOOL_OR(followed) FROM (
+		SELECT UNNEST(tags) AS tag, false AS followed FROM posts WHERE user_id = $1
+		UNION ALL
+		SELECT UNNEST(p.tags), false FROM post_reactions r JOIN posts p ON p.id = r.post_id WHERE r.user_id = $1
+		UNION ALL
+		SELECT t.name, true FROM tag_follows tf JOIN tags t ON t.id = tf.tag_id WHERE tf.user_id = $1
+	) t
+	GROUP BY tag`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := map[string]int{}
+	followed := map[string]bool{}
+	most := 0
+	for rows.Next() {
+		var tag string
+		var count int
+		var isFollowed bool
+		if err := rows.Scan(&tag, &count, &isFollowed); err != nil {
+			return nil, err
+		}
+		counts[tag] = count
+		followed[tag] = isFollowed
+		most = max(most, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	affinity := make(map[string]float64, len(counts))
+	for tag, count := range counts {
+		affinity[tag] = float64(count) / float64(most)
+		if followed[tag] {
+			affinity[tag] = 1
+		}
+	}
+	return affinity, nil
+}
@@ -0,0 +1,69 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFeedRankers(t *testing.T) {
+	now := time.Date(2024, 1, 2, 12, 0, 0, 0, time.UTC)
+	post := func(id int64, age time.Duration, comments, reactions int, tags ...string) *PostWithMetadata {
+		return &PostWithMetadata{
+			Post: Post{
+				ID:        id,
+				CreatedAt: now.Add(-age).Format(time.RFC3339Nano),
+				Tags:      tags,
+			},
+			CommentCount:   comments,
+			ReactionCounts: map[string]int{"like": reactions},
+		}
+	}
+	rank := func(ranker FeedRanker, rc RankingContext, posts ...*PostWithMetadata) []int64 {
+		RankFeed(posts, ranker, rc)
+		ids := make([]int64, len(posts))
+		for i, p := range posts {
+			ids[i] = p.Post.ID
+		}
+		return ids
+	}
+	check := func(t *testing.T, expected, actual []int64) {
+		t.Helper()
+		for i := range expected {
+			if expected[i] != actual[i] {
+				t.Fatalf("expected order %v, got %v", expected, actual)
+			}
+		}
+	}
+
+	t.Run("should rank the newest posts first", func(t *testing.T) {
+		ids := rank(ChronologicalRanker{}, RankingContext{Now: now},
+			post(1, time.Hour*3, 10, 10),
+			post(2, time.Hour, 0, 0),
+			post(3, time.Hour*2, 5, 0),
+		)
+		check(t, []int64{2, 3, 1}, ids)
+	})
+	t.Run("should weigh engagement against age", func(t *testing.T) {
+		ranker := EngagementRanker{CommentWeight: 2, ReactionWeight: 1, HalfLife: time.Hour * 12}
+		ids := rank(ranker, RankingContext{Now: now},
+			// 21 halved once
+			post(1, time.Hour*12, 5, 10),
+			// 1, brand new
+			post(2, 0, 0, 0),
+			// 21 halved twice
+			post(3, time.Hour*24, 5, 10),
+			// 11 halved once
+			post(4, time.Hour*12, 0, 10),
+		)
+		check(t, []int64{1, 4, 3, 2}, ids)
+	})
+	t.Run("should favour the tags of the viewer", func(t *testing.T) {
+		rc := RankingContext{Now: now, TagAffinity: map[string]float64{"go": 1, "sql": 0.5}}
+		ids := rank(TagAffinityRanker{HalfLife: time.Hour * 24}, rc,
+			post(1, time.Hour, 0, 0, "rust"),
+			post(2, time.Hour, 0, 0, "sql"),
+			post(3, time.Hour*2, 0, 0, "go", "sql"),
+		)
+		check(t, []int64{3, 2, 1}, ids)
+	})
+}
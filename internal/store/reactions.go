@@ -0,0 +1,54 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Set gives the reaction of the user to the post, replacing the previous one
+func (s *ReactionStore) Set(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `INSERT INTO post_reactions (post_id, user_id, type)
+	VALUES ($1, $2, $3)
+	ON CONFLICT (post_id, user_id) DO UPDATE
+	SET type = EXCLUDED.type, created_at = NOW()
+	WHERE post_reactions.type <> EXCLUDED.type`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, postID, userID, reaction)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrorNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes the reaction of the user to the post when it is of the given type
+func (s *ReactionStore) Delete(ctx context.Context, postID, userID int64, reaction string) error {
+	query := `DELETE FROM post_reactions WHERE post_id = $1 AND user_id = $2 AND type = $3`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, postID, userID, reaction)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
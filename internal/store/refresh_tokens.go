@@ -0,0 +1,80 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+func (s *RefreshTokenStore) Create(ctx context.Context, userID int64, hashToken string, exp time.Duration) error {
+	query := `INSERT INTO refresh_tokens (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken, userID, time.Now().Add(exp))
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// Rotate consumes a valid refresh token and replaces it with a new one,
+// returning the id of the user the token belonged to
+func (s *RefreshTokenStore) Rotate(ctx context.Context, oldHashToken, newHashToken string, exp time.Duration) (int64, error) {
+	var userID int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM refresh_tokens WHERE token = $1 AND expiry > $2 RETURNING user_id`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		err := tx.QueryRowContext(ctx, query, oldHashToken, time.Now()).Scan(&userID)
+		if err != nil {
+			switch err {
+			case sql.ErrNoRows:
+				return ErrorNotFound
+			default:
+				return err
+			}
+		}
+
+		query = `INSERT INTO refresh_tokens (token, user_id, expiry) VALUES ($1, $2, $3)`
+		_, err = tx.ExecContext(ctx, query, newHashToken, userID, time.Now().Add(exp))
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return userID, nil
+}
+
+func (s *RefreshTokenStore) Delete(ctx context.Context, userID int64, hashToken string) error {
+	query := `DELETE FROM refresh_tokens WHERE token = $1 AND user_id = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *RefreshTokenStore) DeleteByUserID(ctx context.Context, userID int64) error {
+	query := `DELETE FROM refresh_tokens WHERE user_id = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
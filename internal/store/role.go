@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 type RoleStore struct {
@@ -11,9 +13,16 @@ type RoleStore struct {
 }
 
 type Role struct {
+	ID          int64    `json:"id"`
+	Name        string   `json:"name"`
+	Level       int      `json:"level"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions,omitempty"`
+}
+
+type Permission struct {
 	ID          int64  `json:"id"`
 	Name        string `json:"name"`
-	Level       int    `json:"level"`
 	Description string `json:"description"`
 }
 
@@ -38,3 +47,125 @@ func (s *RoleStore) GetByName(ctx context.Context, roleName string) (*Role, erro
 	}
 	return &role, nil
 }
+
+// GetAll returns every role with the names of its permissions
+func (s *RoleStore) GetAll(ctx context.Context) ([]Role, error) {
+	query := `SELECT r.id, r.name, r.level, COALESCE(r.description, ''),
+	COALESCE(ARRAY_AGG(p.name ORDER BY p.name) FILTER (WHERE p.name IS NOT NULL), '{}')
+	FROM roles r
+	LEFT JOIN role_permissions rp ON rp.role_id = r.id
+	LEFT JOIN permissions p ON p.id = rp.permission_id
+	GROUP BY r.id
+	ORDER BY r.id`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Level,
+			&role.Description,
+			pq.Array(&role.Permissions),
+		)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, rows.Err()
+}
+
+func (s *RoleStore) GetPermissions(ctx context.Context) ([]Permission, error) {
+	query := `SELECT id, name, COALESCE(description, '') FROM permissions ORDER BY name`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// Create adds a custom role with the given permissions
+func (s *RoleStore) Create(ctx context.Context, role *Role) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `INSERT INTO roles (name, level, description) VALUES ($1, $2, $3) RETURNING id`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		err := tx.QueryRowContext(ctx, query, role.Name, role.Level, role.Description).Scan(&role.ID)
+		if err != nil {
+			if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+				return ErrorConflict
+			}
+			return err
+		}
+		return s.setPermissions(ctx, tx, role.ID, role.Permissions)
+	})
+}
+
+// SetPermissions replaces the permissions of the role
+func (s *RoleStore) SetPermissions(ctx context.Context, roleID int64, permissions []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM role_permissions WHERE role_id = $1`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		if _, err := tx.ExecContext(ctx, query, roleID); err != nil {
+			return err
+		}
+		return s.setPermissions(ctx, tx, roleID, permissions)
+	})
+}
+
+// setPermissions grants the permissions to the role, it fails with ErrorNotFound for an unknown permission
+func (s *RoleStore) setPermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []string) error {
+	if len(permissions) == 0 {
+		return nil
+	}
+	query := `INSERT INTO role_permissions (role_id, permission_id)
+	SELECT $1, id FROM permissions WHERE name = ANY($2)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := tx.ExecContext(ctx, query, roleID, pq.Array(permissions))
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrorNotFound
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows != int64(len(permissions)) {
+		return ErrorNotFound
+	}
+	return nil
+}
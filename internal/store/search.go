@@ -0,0 +1,154 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// SearchHit is a search result with its relevance and the matching parts of its text. Snippet
+// is HTML: the text is escaped and the matches are wrapped in <mark> tags
+type SearchHit struct {
+	Rank    float64  `json:"rank"`
+	Snippet string   `json:"snippet"`
+	Post    *Post    `json:"post,omitempty"`
+	Comment *Comment `json:"comment,omitempty"`
+	User    *User    `json:"user,omitempty"`
+}
+
+type searchCursor struct {
+	Rank float64 `json:"rank"`
+	ID   int64   `json:"id"`
+}
+
+const searchHeadline = `'MaxFragments=2, MaxWords=20, MinWords=5, StartSel=<mark>, StopSel=</mark>'`
+
+// escapeHTML returns the sql expression escaping the html of the text expression, user text is
+// escaped before ts_headline adds its tags so snippets are safe to render as html
+func escapeHTML(expr string) string {
+	return `replace(replace(replace(replace(replace(` + expr +
+		`, '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;')`
+}
+
+// searchTypes are the searchable resources. $1 is the websearch query, $2 and $3 the rank and id
+// of the cursor and $4 the limit, rows start with their id and rank
+var searchTypes = map[string]struct {
+	query string
+	scan  func(*sql.Rows) (int64, SearchHit, error)
+}{
+	"posts": {
+		query: `SELECT p.id, ts_rank(p.search, q) AS rank,
+			ts_headline('english', ` + escapeHTML(`p.title || ' ' || p.content`) + `, q, ` + searchHeadline + `),
+			p.user_id, p.title, p.content, p.tags, p.created_at, u.username
+		FROM posts p
+		JOIN users u ON u.id = p.user_id,
+		websearch_to_tsquery('english', $1) q
+		WHERE p.search @@ q AND ($3::BIGINT IS NULL OR (ts_rank(p.search, q), p.id) < ($2::REAL, $3))
+		ORDER BY rank DESC, p.id DESC
+		LIMIT $4`,
+		scan: func(rows *sql.Rows) (int64, SearchHit, error) {
+			var hit SearchHit
+			var p Post
+			err := rows.Scan(&p.ID, &hit.Rank, &hit.Snippet, &p.UserID, &p.Title, &p.Content, pq.Array(&p.Tags), &p.CreatedAt, &p.User.Username)
+			p.User.ID = p.UserID
+			hit.Post = &p
+			return p.ID, hit, err
+		},
+	},
+	"comments": {
+		query: `SELECT c.id, ts_rank(c.search, q) AS rank,
+			ts_headline('english', ` + escapeHTML(`c.content`) + `, q, ` + searchHeadline + `),
+			c.post_id, c.user_id, c.content, c.created_at, u.username
+		FROM comments c
+		JOIN users u ON u.id = c.user_id,
+		websearch_to_tsquery('english', $1) q
+		WHERE c.search @@ q AND c.removed_at IS NULL AND
+			($3::BIGINT IS NULL OR (ts_rank(c.search, q), c.id) < ($2::REAL, $3))
+		ORDER BY rank DESC, c.id DESC
+		LIMIT $4`,
+		scan: func(rows *sql.Rows) (int64, SearchHit, error) {
+			var hit SearchHit
+			var c Comment
+			err := rows.Scan(&c.ID, &hit.Rank, &hit.Snippet, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username)
+			c.User.ID = c.UserID
+			hit.Comment = &c
+			return c.ID, hit, err
+		},
+	},
+	"users": {
+		query: `SELECT u.id, ts_rank(u.search, q) AS rank,
+			ts_headline('simple', ` + escapeHTML(`u.username`) + `, q, ` + searchHeadline + `),
+			u.username, u.created_at
+		FROM users u,
+		websearch_to_tsquery('simple', $1) q
+		WHERE u.search @@ q AND u.is_active = true AND
+			($3::BIGINT IS NULL OR (ts_rank(u.search, q), u.id) < ($2::REAL, $3))
+		ORDER BY rank DESC, u.id DESC
+		LIMIT $4`,
+		scan: func(rows *sql.Rows) (int64, SearchHit, error) {
+			var hit SearchHit
+			var u User
+			err := rows.Scan(&u.ID, &hit.Rank, &hit.Snippet, &u.Username, &u.CreatedAt)
+			hit.User = &u
+			return u.ID, hit, err
+		},
+	},
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Search returns the most relevant hits of the query type first, with the cursor of the next
+// page which is empty on the last page
+func (s *SearchStore) Search(ctx context.Context, q PaginatedSearchQuery) ([]SearchHit, string, error) {
+	st, ok := searchTypes[q.Type]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown search type %s", q.Type)
+	}
+	var cursorRank float64
+	var cursorID *int64
+	if q.Cursor != "" {
+		var cursor searchCursor
+		if err := decodeCursor(q.Cursor, &cursor); err != nil {
+			return nil, "", err
+		}
+		cursorRank, cursorID = cursor.Rank, &cursor.ID
+	}
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	// one more row than the limit tells whether there is a next page
+	rows, err := s.db.QueryContext(ctx, st.query, q.Query, cursorRank, cursorID, q.Limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+
+	hits := []SearchHit{}
+	var ids []int64
+	for rows.Next() {
+		id, hit, err := st.scan(rows)
+		if err != nil {
+			return nil, "", err
+		}
+		hits = append(hits, hit)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	if len(hits) <= q.Limit {
+		return hits, "", nil
+	}
+	hits = hits[:q.Limit]
+	next, err := encodeCursor(searchCursor{Rank: hits[q.Limit-1].Rank, ID: ids[q.Limit-1]})
+	if err != nil {
+		return nil, "", err
+	}
+	return hits, next, nil
+}
@@ -21,7 +21,14 @@ type Storage struct {
 		GetById(context.Context, int64) (*Post, error)
 		DeleteById(context.Context, int64) error
 		UpdatePostById(context.Context, *Post) error
-		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetUserFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error)
+		GetUserPosts(context.Context, int64, int64, PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error)
+		GetExploreFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error)
+		GetRankedFeed(context.Context, int64, PaginatedFeedQuery) ([]*PostWithMetadata, error)
+		GetTagPosts(context.Context, int64, int64, PaginatedFeedQuery) ([]*PostWithMetadata, *FeedCursors, error)
+		GetFeedByIDs(context.Context, int64, []int64) ([]*PostWithMetadata, error)
+		GetTimelineEntries(context.Context, []int64, int) ([]TimelineEntry, error)
+		GetFollowedTagEntries(context.Context, int64, int) ([]TimelineEntry, error)
 	}
 	Users interface {
 		Create(context.Context, *sql.Tx, *User) error
@@ -31,27 +38,102 @@ type Storage struct {
 		GetByUsername(context.Context, string) (*User, error)
 		CreateAndInvite(context.Context, *User, string, time.Duration) error
 		Activate(context.Context, string) error
+		ResendInvitation(context.Context, string, string, time.Duration) (*User, error)
+		PurgeExpiredInvitations(context.Context) (int64, int64, error)
+		SetRole(context.Context, int64, int64) error
+		GetAnyById(context.Context, int64) (*User, error)
+		Search(context.Context, PaginatedUserQuery) ([]*User, error)
+		GetActiveIDs(context.Context, int64, int) ([]int64, error)
+		Suspend(context.Context, int64, time.Time, string) error
+		Unsuspend(context.Context, int64) error
+		CreatePasswordReset(context.Context, int64, string, time.Duration) error
+		ResetPassword(context.Context, string, *Password) (*User, error)
+		UpdateProfile(context.Context, *User, ProfileChanges) error
+		ConfirmEmailChange(context.Context, string) (*User, error)
 	}
 	Comments interface {
-		GetByPostID(context.Context, int64) ([]Comment, error)
+		List(context.Context, int64, PaginatedCommentQuery) ([]Comment, string, error)
+		GetReplies(context.Context, []int64, int) ([]Comment, map[int64]string, error)
+		GetThreadReplies(context.Context, int64, PaginatedReplyQuery) ([]Comment, string, error)
+		CountByPostID(context.Context, int64) (int, error)
+		GetById(context.Context, int64) (*Comment, error)
+		Update(context.Context, *Comment) error
+		Delete(context.Context, int64) error
+		Remove(context.Context, int64) error
 		Create(context.Context, *Comment) error
 	}
+	Reactions interface {
+		Set(context.Context, int64, int64, string) error
+		Delete(context.Context, int64, int64, string) error
+	}
 	Followers interface {
 		Follow(context.Context, int64, int64) error
 		Unfollow(context.Context, int64, int64) error
+		GetFollowerIDs(context.Context, int64, int) ([]int64, error)
+		GetFollowing(context.Context, int64) ([]FollowedUser, error)
 	}
 	Role interface {
 		GetByName(ctx context.Context, roleName string) (*Role, error)
+		GetAll(context.Context) ([]Role, error)
+		GetPermissions(context.Context) ([]Permission, error)
+		Create(context.Context, *Role) error
+		SetPermissions(context.Context, int64, []string) error
+	}
+	RefreshTokens interface {
+		Create(context.Context, int64, string, time.Duration) error
+		Rotate(context.Context, string, string, time.Duration) (int64, error)
+		Delete(context.Context, int64, string) error
+		DeleteByUserID(context.Context, int64) error
+	}
+	MFA interface {
+		SetTOTPSecret(context.Context, int64, string) error
+		EnableTOTP(context.Context, int64, []string) error
+		DisableTOTP(context.Context, int64) error
+		UseTOTPStep(context.Context, int64, int64) (bool, error)
+		UseRecoveryCode(context.Context, int64, string) (bool, error)
+	}
+	PersonalAccessTokens interface {
+		Create(context.Context, *PersonalAccessToken, string) error
+		GetByUserID(context.Context, int64) ([]PersonalAccessToken, error)
+		GetByToken(context.Context, string) (*PersonalAccessToken, error)
+		Touch(context.Context, int64) error
+		Delete(context.Context, int64, int64) error
+	}
+	Audit interface {
+		Create(context.Context, *AuditEvent) error
+		List(context.Context, PaginatedAuditQuery) ([]AuditEvent, error)
+	}
+	Tags interface {
+		GetByName(context.Context, string) (*Tag, error)
+		Follow(context.Context, int64, int64) error
+		Unfollow(context.Context, int64, int64) error
+		GetTrending(context.Context, time.Duration, int) ([]TrendingTag, error)
+	}
+	Search interface {
+		Search(context.Context, PaginatedSearchQuery) ([]SearchHit, string, error)
+	}
+	Identities interface {
+		GetBySubject(context.Context, string, string) (*UserIdentity, error)
+		Create(context.Context, *UserIdentity) error
+		CreateUser(context.Context, *User, *UserIdentity) error
 	}
 }
 
 func NewStorage(db *sql.DB) Storage {
 	return Storage{
-		Posts:     &PostStore{db: db},
-		Users:     &UserStore{db: db},
-		Comments:  &CommentStore{db: db},
-		Followers: &FollowerStore{db: db},
-		Role:      &RoleStore{db: db},
+		Posts:                &PostStore{db: db},
+		Users:                &UserStore{db: db},
+		Comments:             &CommentStore{db: db},
+		Reactions:            &ReactionStore{db: db},
+		Followers:            &FollowerStore{db: db},
+		Role:                 &RoleStore{db: db},
+		RefreshTokens:        &RefreshTokenStore{db: db},
+		MFA:                  &MFAStore{db: db},
+		PersonalAccessTokens: &PersonalAccessTokenStore{db: db},
+		Identities:           &IdentityStore{db: db},
+		Audit:                &AuditStore{db: db},
+		Search:               &SearchStore{db: db},
+		Tags:                 &TagStore{db: db},
 	}
 }
 
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"golang.org/x/text/unicode/norm"
+)
+
+type Tag struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	UsageCount int    `json:"usage_count"`
+	CreatedAt  string `json:"created_at"`
+}
+
+// TrendingTag is a tag with its uses in the window and in the window before it
+type TrendingTag struct {
+	Name         string `json:"name"`
+	Uses         int    `json:"uses"`
+	PreviousUses int    `json:"previous_uses"`
+	// Velocity is how many more uses per hour the tag had than in the previous window
+	Velocity float64 `json:"velocity"`
+}
+
+// MaxTagLength is the number of characters the name of a tag can have
+const MaxTagLength = 100
+
+// NormalizeTag folds the ways of writing a tag into one: Unicode NFKC, lower case, without
+// surrounding spaces or a leading #. NFKC comes first so full-width spaces and # are trimmed too
+func NormalizeTag(tag string) string {
+	tag = norm.NFKC.String(tag)
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	return strings.ToLower(tag)
+}
+
+// NormalizeTags normalizes the tags and drops the empty and duplicate ones, in order
+func NormalizeTags(tags []string) []string {
+	if tags == nil {
+		return nil
+	}
+	normalized := []string{}
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+type TagStore struct {
+	db *sql.DB
+}
+
+// GetByName returns the tag with the normalized name
+func (s *TagStore) GetByName(ctx context.Context, name string) (*Tag, error) {
+	query := `SELECT id, name, usage_count, created_at FROM tags WHERE name = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	var tag Tag
+	err := s.db.QueryRowContext(ctx, query, name).Scan(&tag.ID, &tag.Name, &tag.UsageCount, &tag.CreatedAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return &tag, nil
+}
+
+func (s *TagStore) Follow(ctx context.Context, userID, tagID int64) error {
+	query := `INSERT INTO tag_follows (user_id, tag_id) VALUES ($1, $2)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, userID, tagID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23505" {
+			return ErrorConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *TagStore) Unfollow(ctx context.Context, userID, tagID int64) error {
+	query := `DELETE FROM tag_follows WHERE user_id = $1 AND tag_id = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := s.db.ExecContext(ctx, query, userID, tagID)
+	return err
+}
+
+// GetTrending returns the tags used in the last window whose use grew the most compared to
+// the window before it
+func (s *TagStore) GetTrending(ctx context.Context, window time.Duration, limit int) ([]TrendingTag, error) {
+	query := `SELECT name, uses, previous_uses FROM (
+		SELECT t.name,
+			COUNT(*) FILTER (WHERE pt.created_at > NOW() - make_interval(secs => $1)) AS uses,
+			COUNT(*) FILTER (WHERE pt.created_at <= NOW() - make_interval(secs => $1)) AS previous_uses
+		FROM post_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.created_at > NOW() - 2 * make_interval(secs => $1)
+		GROUP BY t.name
+	) w
+	WHERE uses > 0
+	ORDER BY uses - previous_uses DESC, uses DESC, name
+	LIMIT $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, window.Seconds(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TrendingTag{}
+	for rows.Next() {
+		var t TrendingTag
+		if err := rows.Scan(&t.Name, &t.Uses, &t.PreviousUses); err != nil {
+			return nil, err
+		}
+		t.Velocity = float64(t.Uses-t.PreviousUses) / window.Hours()
+		tags = append(tags, t)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,29 @@
+package store
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	cases := map[string]string{
+		"Go":         "go",
+		" #GoLang ":  "golang",
+		"Ｇｏ":         "go",
+		"cafe\u0301": "caf\u00e9",
+		"ÜBER":       "über",
+		"##":         "",
+		"＃Ｇｏ":        "go",
+		"\u3000#go":  "go",
+	}
+	for tag, expected := range cases {
+		if actual := NormalizeTag(tag); actual != expected {
+			t.Errorf("expected %q to normalize to %q, got %q", tag, expected, actual)
+		}
+	}
+
+	tags := NormalizeTags([]string{"Go", "#go", "", "SQL", "go "})
+	if expected := []string{"go", "sql"}; !slices.Equal(tags, expected) {
+		t.Errorf("expected %v, got %v", expected, tags)
+	}
+}
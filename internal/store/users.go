@@ -8,6 +8,7 @@ import (
 	"errors"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -20,7 +21,19 @@ type User struct {
 	IsActive  bool     `json:"is_active"`
 	RoleID    int64    `json:"role_id,omitempty"`
 	Role      Role     `json:"role,omitempty"`
+	// TOTPSecret is set once enrollment starts, TOTPEnabled once the first code is verified
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// SuspendedUntil is set by an admin, the user can't sign in until then
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
 }
+
+// IsSuspended reports whether the suspension of the user is still running
+func (u *User) IsSuspended() bool {
+	return u.SuspendedUntil != nil && time.Now().Before(*u.SuspendedUntil)
+}
+
 type Password struct {
 	text *string
 	hash []byte
@@ -45,18 +58,11 @@ type UserStore struct {
 }
 
 func (s *UserStore) GetById(ctx context.Context, userId int64) (*User, error) {
-	query := `SELECT 
-    users.id AS user_id, 
-    username, 
-    email, 
-    password, 
-    created_at, 
-    is_active, 
-    roles.* 
+	query := `SELECT ` + userColumns + `
 	FROM users
 	JOIN roles ON roles.id = users.role_id
 	WHERE users.id = $1 AND is_active = true;`
-	user, err := s.getUser(ctx, query, &userId, "")
+	user, err := s.getUser(ctx, query, userId)
 	if err != nil {
 		return nil, err
 	}
@@ -64,8 +70,11 @@ func (s *UserStore) GetById(ctx context.Context, userId int64) (*User, error) {
 }
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
-	query := `Select id, username, email, password, created_at, is_active FROM users where email = $1 and is_active= true`
-	user, err := s.getUser(ctx, query, nil, email)
+	query := `SELECT ` + userColumns + `
+	FROM users
+	JOIN roles ON roles.id = users.role_id
+	WHERE email = $1 AND is_active = true`
+	user, err := s.getUser(ctx, query, email)
 	if err != nil {
 		return nil, err
 	}
@@ -73,20 +82,136 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 }
 
 func (s *UserStore) GetByUsername(ctx context.Context, username string) (*User, error) {
-	query := `Select id, username, email, password, created_at, is_active FROM users where username = $1 and is_active= true`
-	user, err := s.getUser(ctx, query, nil, username)
+	query := `SELECT ` + userColumns + `
+	FROM users
+	JOIN roles ON roles.id = users.role_id
+	WHERE username = $1 AND is_active = true`
+	user, err := s.getUser(ctx, query, username)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
+// GetAnyById returns the user whether the account is active or not
+func (s *UserStore) GetAnyById(ctx context.Context, userId int64) (*User, error) {
+	query := `SELECT ` + userColumns + `
+	FROM users
+	JOIN roles ON roles.id = users.role_id
+	WHERE users.id = $1`
+	return s.getUser(ctx, query, userId)
+}
+
+// GetActiveIDs returns up to limit ids of active users after afterID, in order
+func (s *UserStore) GetActiveIDs(ctx context.Context, afterID int64, limit int) ([]int64, error) {
+	query := `SELECT id FROM users WHERE is_active = true AND id > $1 ORDER BY id LIMIT $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Search lists the users matching the query, inactive accounts included
+func (s *UserStore) Search(ctx context.Context, q PaginatedUserQuery) ([]*User, error) {
+	query := `SELECT ` + userColumns + `
+	FROM users
+	JOIN roles ON roles.id = users.role_id
+	WHERE
+		(username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%') AND
+		($2 = '' OR roles.name = $2) AND
+		($3::BOOLEAN IS NULL OR is_active = $3)
+	ORDER BY users.id
+	LIMIT $4 OFFSET $5`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	rows, err := s.db.QueryContext(ctx, query, q.Search, q.Role, q.Active, q.Limit, q.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []*User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// Suspend blocks the user until the given time and drops the refresh tokens of the user
+func (s *UserStore) Suspend(ctx context.Context, userID int64, until time.Time, reason string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET suspended_until = $1, suspension_reason = $2 WHERE id = $3`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		res, err := tx.ExecContext(ctx, query, until, reason, userID)
+		if err != nil {
+			return err
+		}
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrorNotFound
+		}
+		return s.deleteRefreshTokens(ctx, tx, userID)
+	})
+}
+
+func (s *UserStore) Unsuspend(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET suspended_until = NULL, suspension_reason = NULL WHERE id = $1`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+// Delete removes the user along with the posts and comments of the user
 func (s *UserStore) Delete(ctx context.Context, userID int64) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.deleteUserInvitations(ctx, tx, userID); err != nil {
 			return err
 		}
 
+		if err := s.deleteUserContent(ctx, tx, userID); err != nil {
+			return err
+		}
+
 		if err := s.deleteUserById(ctx, tx, userID); err != nil {
 			return err
 		}
@@ -132,6 +257,208 @@ func (s *UserStore) Activate(ctx context.Context, token string) error {
 	})
 }
 
+// ResendInvitation replaces the invitation of the inactive user with the given email
+func (s *UserStore) ResendInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getInactiveUserByEmail(ctx, tx, email)
+		if err != nil {
+			return err
+		}
+		// only the latest activation link stays valid
+		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		return s.createUserInviations(ctx, tx, invitationExp, token, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// PurgeExpiredInvitations deletes the users which never activated their account before
+// all of their invitations expired, along with the invitations. It returns the number of
+// users and invitations removed
+func (s *UserStore) PurgeExpiredInvitations(ctx context.Context) (int64, int64, error) {
+	var users, invitations int64
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `DELETE FROM users
+		WHERE is_active = false AND id IN (
+			SELECT user_id FROM user_invitations GROUP BY user_id HAVING MAX(expiry) <= $1
+		)
+		RETURNING id`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		rows, err := tx.QueryContext(ctx, query, time.Now())
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		ids := []int64{}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		users = int64(len(ids))
+		if users == 0 {
+			return nil
+		}
+
+		query = `DELETE FROM user_invitations WHERE user_id = ANY($1)`
+		res, err := tx.ExecContext(ctx, query, pq.Array(ids))
+		if err != nil {
+			return err
+		}
+		invitations, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return users, invitations, nil
+}
+
+// SetRole assigns the role to the user
+func (s *UserStore) SetRole(ctx context.Context, userID int64, roleID int64) error {
+	query := `UPDATE users SET role_id = $1 WHERE id = $2`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	res, err := s.db.ExecContext(ctx, query, roleID, userID)
+	if err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+			return ErrorNotFound
+		}
+		return err
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrorNotFound
+	}
+	return nil
+}
+
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		// only the latest reset link stays valid
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		defer cancelCtx()
+
+		_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword sets the new password for the user the reset token belongs to,
+// consumes the token and drops all refresh tokens of the user
+func (s *UserStore) ResetPassword(ctx context.Context, token string, password *Password) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var err error
+		user, err = s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user.Password = *password
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+		return s.deleteRefreshTokens(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ProfileChanges are the changes to a profile besides the username
+type ProfileChanges struct {
+	// Password is set when the password of the user was changed
+	Password bool
+	// Email is a new email which takes effect once the hashed EmailToken is confirmed
+	Email      string
+	EmailToken string
+	EmailExp   time.Duration
+}
+
+// UpdateProfile saves the username and the changes of the user in one transaction, either all of
+// them or none are applied
+func (s *UserStore) UpdateProfile(ctx context.Context, user *User, changes ProfileChanges) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+		if changes.Password {
+			if err := s.updatePassword(ctx, tx, user); err != nil {
+				return err
+			}
+		}
+		if changes.Email != "" {
+			return s.createEmailChange(ctx, tx, user.ID, changes.Email, changes.EmailToken, changes.EmailExp)
+		}
+		return nil
+	})
+}
+
+func (s *UserStore) createEmailChange(ctx context.Context, tx *sql.Tx, userID int64, email string, token string, exp time.Duration) error {
+	// only the latest requested email can be confirmed
+	if err := s.deleteEmailChanges(ctx, tx, userID); err != nil {
+		return err
+	}
+	query := `INSERT INTO email_changes (token, user_id, email, expiry) VALUES ($1, $2, $3, $4)`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := tx.ExecContext(ctx, query, token, userID, email, time.Now().Add(exp))
+	return err
+}
+
+// ConfirmEmailChange moves the user to the email the confirmation token was sent to
+func (s *UserStore) ConfirmEmailChange(ctx context.Context, token string) (*User, error) {
+	var user *User
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		var email string
+		var err error
+		user, email, err = s.getUserFromEmailChange(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+		user.Email = email
+		if err := s.update(ctx, tx, user); err != nil {
+			return err
+		}
+		return s.deleteEmailChanges(ctx, tx, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
 // should be private
 
 func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
@@ -186,6 +513,32 @@ func (s *UserStore) createUserInviations(ctx context.Context, tx *sql.Tx, exp ti
 	return nil
 }
 
+func (s *UserStore) getInactiveUserByEmail(ctx context.Context, tx *sql.Tx, email string) (*User, error) {
+	query := `SELECT id, username, email, created_at, is_active
+	FROM users
+	WHERE email = $1 AND is_active = false`
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, email).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
 func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
 	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active 
 	FROM users u
@@ -222,6 +575,123 @@ func (s *UserStore) update(ctx context.Context, tx *sql.Tx, user *User) error {
 	defer cancelCtx()
 
 	_, err := tx.ExecContext(ctx, query, user.Username, user.Email, user.IsActive, user.ID)
+	if err != nil {
+		switch {
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
+			return ErrorDuplicateEmail
+		case err.Error() == `pq: duplicate key value violates unique constraint "users_username_key"`:
+			return ErrorDuplicateUsername
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *UserStore) getUserFromEmailChange(ctx context.Context, tx *sql.Tx, token string) (*User, string, error) {
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active, ec.email
+	FROM users u
+	JOIN email_changes ec ON u.id = ec.user_id
+	WHERE ec.token = $1 AND ec.expiry > $2
+	`
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString((hash[:]))
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+	user := &User{}
+	var email string
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+		&email,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, "", ErrorNotFound
+		default:
+			return nil, "", err
+		}
+	}
+	return user, email, nil
+}
+
+func (s *UserStore) deleteEmailChanges(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM email_changes where user_id = $1`
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `SELECT u.id, u.username, u.email, u.created_at, u.is_active 
+	FROM users u
+	JOIN password_resets pr ON u.id = pr.user_id
+	WHERE pr.token = $1 AND pr.expiry > $2
+	`
+	hash := sha256.Sum256([]byte(token))
+	hashToken := hex.EncodeToString((hash[:]))
+
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, hashToken, time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			return nil, ErrorNotFound
+		default:
+			return nil, err
+		}
+	}
+	return user, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1 where id = $2`
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets where user_id = $1`
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (s *UserStore) deleteRefreshTokens(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM refresh_tokens where user_id = $1`
+	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+	defer cancelCtx()
+
+	_, err := tx.ExecContext(ctx, query, userID)
 	if err != nil {
 		return err
 	}
@@ -240,6 +710,31 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 	return nil
 }
 
+// deleteUserContent deletes the posts of the user with their comments and the comments of the user,
+// comments of the user with replies of others become tombstones so the replies stay
+func (s *UserStore) deleteUserContent(ctx context.Context, tx *sql.Tx, userID int64) error {
+	queries := []struct {
+		query string
+		args  []any
+	}{
+		{`DELETE FROM comments WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)`, []any{userID}},
+		{`UPDATE comments c SET content = $2, removed_at = NOW()
+		WHERE user_id = $1 AND removed_at IS NULL AND EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)`, []any{userID, RemovedCommentContent}},
+		{`DELETE FROM comments c
+		WHERE user_id = $1 AND NOT EXISTS (SELECT 1 FROM comments r WHERE r.parent_id = c.id)`, []any{userID}},
+		{`DELETE FROM posts WHERE user_id = $1`, []any{userID}},
+	}
+	for _, q := range queries {
+		ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
+		_, err := tx.ExecContext(ctx, q.query, q.args...)
+		cancelCtx()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *UserStore) deleteUserById(ctx context.Context, tx *sql.Tx, userID int64) error {
 	query := `DELETE FROM users where id = $1`
 	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
@@ -252,34 +747,26 @@ func (s *UserStore) deleteUserById(ctx context.Context, tx *sql.Tx, userID int64
 	return nil
 }
 
-func (s *UserStore) getUser(ctx context.Context, query string, id *int64, param string) (*User, error) {
+// userColumns are the columns getUser scans, in order
+const userColumns = `users.id, 
+    username, 
+    email, 
+    password, 
+    created_at, 
+    is_active, 
+    COALESCE(totp_secret, ''), 
+    totp_enabled, 
+    suspended_until, 
+    COALESCE(suspension_reason, ''), 
+    roles.id, 
+    roles.name, 
+    roles.level, 
+    roles.description`
+
+func (s *UserStore) getUser(ctx context.Context, query string, arg any) (*User, error) {
 	ctx, cancelCtx := context.WithTimeout(ctx, QueryTimeout)
 	defer cancelCtx()
-	var user User
-	var err error
-	if id != nil {
-		err = s.db.QueryRowContext(ctx, query, *id).Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.Password.hash,
-			&user.CreatedAt,
-			&user.IsActive,
-			&user.Role.ID,
-			&user.Role.Name,
-			&user.Role.Level,
-			&user.Role.Description,
-		)
-	} else {
-		err = s.db.QueryRowContext(ctx, query, param).Scan(
-			&user.ID,
-			&user.Username,
-			&user.Email,
-			&user.Password.hash,
-			&user.CreatedAt,
-			&user.IsActive,
-		)
-	}
+	user, err := scanUser(s.db.QueryRowContext(ctx, query, arg))
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -288,5 +775,31 @@ func (s *UserStore) getUser(ctx context.Context, query string, id *int64, param
 			return nil, err
 		}
 	}
+	return user, nil
+}
+
+// scanUser scans the userColumns of a row
+func scanUser(row interface{ Scan(...any) error }) (*User, error) {
+	var user User
+	err := row.Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.Password.hash,
+		&user.CreatedAt,
+		&user.IsActive,
+		&user.TOTPSecret,
+		&user.TOTPEnabled,
+		&user.SuspendedUntil,
+		&user.SuspensionReason,
+		&user.Role.ID,
+		&user.Role.Name,
+		&user.Role.Level,
+		&user.Role.Description,
+	)
+	if err != nil {
+		return nil, err
+	}
+	user.RoleID = user.Role.ID
 	return &user, nil
 }
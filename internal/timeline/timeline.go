@@ -0,0 +1,168 @@
+package timeline
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/Shadowcyng/goSocial/internal/store/cache"
+)
+
+type Config struct {
+	// Size is the number of posts kept in every timeline, older pages are read from the database
+	Size int
+	// CelebrityFollowers is the follower count above which posts are not pushed to the followers
+	// but merged into their timelines when read
+	CelebrityFollowers int
+	// TTL drops timelines of inactive users, they are rebuilt on their next read
+	TTL time.Duration
+}
+
+// Service keeps the home timelines of the users in the cache. Posts are pushed to the timelines
+// of the followers when created (fan-out on write), except for authors with more than
+// CelebrityFollowers followers and posts of followed tags which are fetched when a timeline is
+// read (fan-out on read). The celebrities a user follows are cached with the timeline, a user
+// becoming one is picked up when the timelines of the followers are rebuilt
+type Service struct {
+	store  store.Storage
+	cache  cache.Storage
+	config Config
+}
+
+func New(store store.Storage, cache cache.Storage, config Config) *Service {
+	return &Service{store: store, cache: cache, config: config}
+}
+
+// FanOut pushes the post to the timelines of the author and the followers of the author
+func (s *Service) FanOut(ctx context.Context, post *store.Post) error {
+	userIDs, err := s.audience(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+	return s.cache.Timelines.Push(ctx, userIDs, entryOf(post), s.config.Size)
+}
+
+// Remove drops a deleted post from the timelines it was pushed to
+func (s *Service) Remove(ctx context.Context, post *store.Post) error {
+	userIDs, err := s.audience(ctx, post.UserID)
+	if err != nil {
+		return err
+	}
+	return s.cache.Timelines.Remove(ctx, userIDs, post.ID, s.config.Size)
+}
+
+// audience returns the users whose timelines the posts of the author are pushed to, the author
+// and the followers unless the author is a celebrity
+func (s *Service) audience(ctx context.Context, authorID int64) ([]int64, error) {
+	// one more follower than the threshold is enough to know the author is a celebrity
+	followers, err := s.store.Followers.GetFollowerIDs(ctx, authorID, s.config.CelebrityFollowers+1)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := []int64{authorID}
+	if len(followers) <= s.config.CelebrityFollowers {
+		userIDs = append(userIDs, followers...)
+	}
+	return userIDs, nil
+}
+
+// Rebuild loads the timeline of the user from the database into the cache, it returns the
+// timeline and the celebrities the user follows
+func (s *Service) Rebuild(ctx context.Context, userID int64) ([]store.TimelineEntry, []int64, error) {
+	following, err := s.store.Followers.GetFollowing(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	authorIDs := []int64{userID}
+	celebrityIDs := []int64{}
+	for _, u := range following {
+		if u.Followers > s.config.CelebrityFollowers {
+			celebrityIDs = append(celebrityIDs, u.ID)
+		} else {
+			authorIDs = append(authorIDs, u.ID)
+		}
+	}
+	entries, err := s.store.Posts.GetTimelineEntries(ctx, authorIDs, s.config.Size)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := s.cache.Timelines.Replace(ctx, userID, entries, celebrityIDs, s.config.TTL); err != nil {
+		return nil, nil, err
+	}
+	return entries, celebrityIDs, nil
+}
+
+// Invalidate drops the timeline of the user, e.g. after following or unfollowing someone
+func (s *Service) Invalidate(ctx context.Context, userID int64) error {
+	return s.cache.Timelines.Delete(ctx, userID)
+}
+
+// Read returns the ids of a page of the timeline of the user, newest first. It reports false
+// when the page is beyond the cached part of the timeline
+func (s *Service) Read(ctx context.Context, userID int64, offset, limit int) ([]int64, bool, error) {
+	count := offset + limit
+	if count > s.config.Size {
+		return nil, false, nil
+	}
+
+	entries, celebrityIDs, exists, err := s.cache.Timelines.Range(ctx, userID, count)
+	if err != nil {
+		return nil, false, err
+	}
+	if !exists {
+		if entries, celebrityIDs, err = s.Rebuild(ctx, userID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	if len(celebrityIDs) > 0 {
+		celebrityEntries, err := s.store.Posts.GetTimelineEntries(ctx, celebrityIDs, count)
+		if err != nil {
+			return nil, false, err
+		}
+		entries = merge(entries, celebrityEntries)
+	}
+	// posts of followed tags are merged like the ones of celebrities
+	tagEntries, err := s.store.Posts.GetFollowedTagEntries(ctx, userID, count)
+	if err != nil {
+		return nil, false, err
+	}
+	entries = merge(entries, tagEntries)
+
+	ids := []int64{}
+	for i := offset; i < len(entries) && i < count; i++ {
+		ids = append(ids, entries[i].PostID)
+	}
+	return ids, true, nil
+}
+
+// merge combines timelines sorted newest first, posts in both are kept once
+func merge(a, b []store.TimelineEntry) []store.TimelineEntry {
+	seen := make(map[int64]bool, len(a)+len(b))
+	merged := make([]store.TimelineEntry, 0, len(a)+len(b))
+	for _, entries := range [][]store.TimelineEntry{a, b} {
+		for _, e := range entries {
+			if !seen[e.PostID] {
+				seen[e.PostID] = true
+				merged = append(merged, e)
+			}
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		if merged[i].CreatedAt.Equal(merged[j].CreatedAt) {
+			return merged[i].PostID > merged[j].PostID
+		}
+		return merged[i].CreatedAt.After(merged[j].CreatedAt)
+	})
+	return merged
+}
+
+// entryOf returns the timeline entry of a post, CreatedAt is set by the database on creation
+func entryOf(post *store.Post) store.TimelineEntry {
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil {
+		createdAt = time.Now()
+	}
+	return store.TimelineEntry{PostID: post.ID, CreatedAt: createdAt}
+}
@@ -0,0 +1,224 @@
+package timeline
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Shadowcyng/goSocial/internal/store"
+	"github.com/Shadowcyng/goSocial/internal/store/cache"
+)
+
+func TestMerge(t *testing.T) {
+	at := func(minutes int) time.Time {
+		return time.Date(2024, 1, 1, 12, minutes, 0, 0, time.UTC)
+	}
+	pushed := []store.TimelineEntry{
+		{PostID: 5, CreatedAt: at(50)},
+		{PostID: 3, CreatedAt: at(30)},
+		{PostID: 1, CreatedAt: at(10)},
+	}
+	celebrity := []store.TimelineEntry{
+		{PostID: 6, CreatedAt: at(30)},
+		{PostID: 4, CreatedAt: at(40)},
+		{PostID: 3, CreatedAt: at(30)},
+	}
+
+	merged := merge(pushed, celebrity)
+	expected := []int64{5, 4, 6, 3, 1}
+	if len(merged) != len(expected) {
+		t.Fatalf("expected %d posts, got %d", len(expected), len(merged))
+	}
+	for i, id := range expected {
+		if merged[i].PostID != id {
+			t.Errorf("expected post %d at %d, got %d", id, i, merged[i].PostID)
+		}
+	}
+}
+
+// countingFollowers counts the loads of the users followed
+type countingFollowers struct {
+	*store.MockFollowerStore
+	calls int
+}
+
+func (f *countingFollowers) GetFollowing(ctx context.Context, userID int64) ([]store.FollowedUser, error) {
+	f.calls++
+	return f.MockFollowerStore.GetFollowing(ctx, userID)
+}
+
+// authorPosts returns the timeline entries of the posts of the authors
+type authorPosts struct {
+	*store.MockPostStore
+	posts map[int64][]store.TimelineEntry
+}
+
+func (p *authorPosts) GetTimelineEntries(ctx context.Context, authorIDs []int64, limit int) ([]store.TimelineEntry, error) {
+	entries := []store.TimelineEntry{}
+	for _, id := range authorIDs {
+		entries = merge(entries, p.posts[id])
+	}
+	return entries[:min(len(entries), limit)], nil
+}
+
+func newTestService(t *testing.T) (*Service, *countingFollowers, *authorPosts) {
+	t.Helper()
+	followers := &countingFollowers{MockFollowerStore: store.NewMockFollowerStore()}
+	posts := &authorPosts{MockPostStore: &store.MockPostStore{}, posts: map[int64][]store.TimelineEntry{}}
+	s := store.NewMockStore()
+	s.Followers = followers
+	s.Posts = posts
+	return New(s, cache.NewMockCache(), Config{Size: 10, CelebrityFollowers: 2, TTL: time.Hour}), followers, posts
+}
+
+func TestFanOut(t *testing.T) {
+	ctx := context.Background()
+	service, followers, _ := newTestService(t)
+
+	// user 1 has 2 followers, user 2 has 3 and is a celebrity
+	for _, follow := range [][2]int64{{1, 10}, {1, 11}, {2, 10}, {2, 11}, {2, 12}} {
+		if err := followers.Follow(ctx, follow[0], follow[1]); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+	for _, userID := range []int64{10, 11, 12} {
+		if _, _, err := service.Rebuild(ctx, userID); err != nil {
+			t.Fatalf("could not build timeline: %v", err)
+		}
+	}
+
+	if err := service.FanOut(ctx, &store.Post{ID: 100, UserID: 1, CreatedAt: time.Now().Format(time.RFC3339Nano)}); err != nil {
+		t.Fatalf("could not fan out: %v", err)
+	}
+	if err := service.FanOut(ctx, &store.Post{ID: 200, UserID: 2, CreatedAt: time.Now().Format(time.RFC3339Nano)}); err != nil {
+		t.Fatalf("could not fan out: %v", err)
+	}
+
+	for _, userID := range []int64{10, 11} {
+		entries, _, _, err := service.cache.Timelines.Range(ctx, userID, 10)
+		if err != nil {
+			t.Fatalf("could not read timeline: %v", err)
+		}
+		if len(entries) != 1 || entries[0].PostID != 100 {
+			t.Errorf("expected the timeline of %d to have post 100 only, got %v", userID, entries)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	ctx := context.Background()
+	at := func(minutes int) time.Time {
+		return time.Date(2024, 1, 1, 12, minutes, 0, 0, time.UTC)
+	}
+
+	t.Run("should not read past the cached timeline", func(t *testing.T) {
+		service, _, _ := newTestService(t)
+		_, ok, err := service.Read(ctx, 10, 5, 6)
+		if err != nil || ok {
+			t.Errorf("expected a page past the size not to be read, got %v %v", ok, err)
+		}
+	})
+	t.Run("should build an empty timeline once", func(t *testing.T) {
+		service, followers, _ := newTestService(t)
+		for i := 0; i < 2; i++ {
+			ids, ok, err := service.Read(ctx, 10, 0, 5)
+			if err != nil || !ok || len(ids) != 0 {
+				t.Fatalf("expected an empty timeline, got %v %v %v", ids, ok, err)
+			}
+		}
+		if followers.calls != 1 {
+			t.Errorf("expected the timeline to be built once, got %d", followers.calls)
+		}
+	})
+	t.Run("should merge the posts of the cached celebrities", func(t *testing.T) {
+		service, followers, posts := newTestService(t)
+		// user 10 follows user 1 and the celebrity user 2
+		for _, follow := range [][2]int64{{1, 10}, {2, 10}, {2, 11}, {2, 12}} {
+			if err := followers.Follow(ctx, follow[0], follow[1]); err != nil {
+				t.Fatalf("could not follow: %v", err)
+			}
+		}
+		posts.posts[1] = []store.TimelineEntry{{PostID: 3, CreatedAt: at(30)}, {PostID: 1, CreatedAt: at(10)}}
+		posts.posts[2] = []store.TimelineEntry{{PostID: 2, CreatedAt: at(20)}}
+
+		for i := 0; i < 2; i++ {
+			ids, ok, err := service.Read(ctx, 10, 0, 5)
+			if err != nil || !ok {
+				t.Fatalf("could not read timeline: %v %v", ok, err)
+			}
+			if !slices.Equal(ids, []int64{3, 2, 1}) {
+				t.Errorf("expected posts 3, 2 and 1, got %v", ids)
+			}
+		}
+		if followers.calls != 1 {
+			t.Errorf("expected the users followed to be loaded once, got %d", followers.calls)
+		}
+
+		// the celebrities are refreshed with the timeline after a follow change
+		if err := followers.Unfollow(ctx, 2, 10); err != nil {
+			t.Fatalf("could not unfollow: %v", err)
+		}
+		if err := service.Invalidate(ctx, 10); err != nil {
+			t.Fatalf("could not invalidate timeline: %v", err)
+		}
+		ids, _, err := service.Read(ctx, 10, 0, 5)
+		if err != nil {
+			t.Fatalf("could not read timeline: %v", err)
+		}
+		if !slices.Equal(ids, []int64{3, 1}) {
+			t.Errorf("expected posts 3 and 1, got %v", ids)
+		}
+	})
+}
+
+func TestRemove(t *testing.T) {
+	ctx := context.Background()
+	at := func(minutes int) time.Time {
+		return time.Date(2024, 1, 1, 12, minutes, 0, 0, time.UTC)
+	}
+	service, followers, posts := newTestService(t)
+
+	// user 10 follows user 1, user 11 follows user 2 who has posted a full timeline
+	for _, follow := range [][2]int64{{1, 10}, {2, 11}} {
+		if err := followers.Follow(ctx, follow[0], follow[1]); err != nil {
+			t.Fatalf("could not follow: %v", err)
+		}
+	}
+	posts.posts[1] = []store.TimelineEntry{{PostID: 3, CreatedAt: at(30)}, {PostID: 1, CreatedAt: at(10)}}
+	for i := 20; i > 0; i-- {
+		posts.posts[2] = append(posts.posts[2], store.TimelineEntry{PostID: int64(100 + i), CreatedAt: at(i)})
+	}
+	for _, userID := range []int64{10, 11} {
+		if _, _, err := service.Rebuild(ctx, userID); err != nil {
+			t.Fatalf("could not build timeline: %v", err)
+		}
+	}
+
+	t.Run("should drop the post from the timelines", func(t *testing.T) {
+		if err := service.Remove(ctx, &store.Post{ID: 3, UserID: 1}); err != nil {
+			t.Fatalf("could not remove post: %v", err)
+		}
+		posts.posts[1] = posts.posts[1][1:]
+		ids, ok, err := service.Read(ctx, 10, 0, 5)
+		if err != nil || !ok {
+			t.Fatalf("could not read timeline: %v %v", ok, err)
+		}
+		if !slices.Equal(ids, []int64{1}) {
+			t.Errorf("expected post 1, got %v", ids)
+		}
+	})
+	t.Run("should fill a full timeline with the next older post", func(t *testing.T) {
+		if err := service.Remove(ctx, &store.Post{ID: 120, UserID: 2}); err != nil {
+			t.Fatalf("could not remove post: %v", err)
+		}
+		posts.posts[2] = posts.posts[2][1:]
+		ids, ok, err := service.Read(ctx, 11, 5, 5)
+		if err != nil || !ok {
+			t.Fatalf("could not read timeline: %v %v", ok, err)
+		}
+		if !slices.Equal(ids, []int64{114, 113, 112, 111, 110}) {
+			t.Errorf("expected a full last page, got %v", ids)
+		}
+	})
+}